@@ -8,11 +8,12 @@ import (
 
 func main() {
 	// 初始化 Bitcask 資料庫
-	bitcask, err := bitcask.NewBitcask("bitcask.db")
+	bitcask, err := bitcask.NewBitcask("bitcask_data")
 	if err != nil {
 		fmt.Printf("Error initializing Bitcask: %v\n", err)
 		return
 	}
+	defer bitcask.Close()
 
 	// 1. 寫入鍵值對
 	fmt.Println("Inserting 'name' -> 'Alice'")
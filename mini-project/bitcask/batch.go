@@ -0,0 +1,224 @@
+package bitcask
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// 批次標記的 value 長度：BEGIN 只記錄批次編號，COMMIT 另外記錄批次中的操作數量
+const (
+	batchBeginValueSize  = 8
+	batchCommitValueSize = 12
+)
+
+// batchSeq 用來產生程序內不重複的批次編號
+var batchSeq atomic.Uint64
+
+// batchOp 為批次中暫存的一個寫入或刪除操作
+type batchOp struct {
+	key   []byte
+	value []byte
+	mark  EntryType
+	ttl   time.Duration // 0 表示永不過期，過期時間在 Commit 時才計算
+}
+
+// WriteBatch 暫存多個 Put 與 Delete，Commit 時以 BEGIN/COMMIT 標記包住一次寫入日誌。
+// 當機後重新開啟時，沒有 COMMIT 標記的批次會被整批忽略。
+type WriteBatch struct {
+	bc  *Bitcask
+	ops []batchOp
+}
+
+// NewWriteBatch 建立一個新的空批次
+func (bc *Bitcask) NewWriteBatch() *WriteBatch {
+	return &WriteBatch{bc: bc}
+}
+
+// Put 暫存一個寫入操作，key 與 value 會被複製，呼叫後可以重複使用
+func (wb *WriteBatch) Put(key, value []byte) {
+	wb.put(key, value, 0)
+}
+
+// PutWithTTL 暫存一個在 ttl 之後過期的寫入操作，ttl 從 Commit 時開始計算
+func (wb *WriteBatch) PutWithTTL(key, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("%w %v", ErrInvalidTTL, ttl)
+	}
+	wb.put(key, value, ttl)
+	return nil
+}
+
+func (wb *WriteBatch) put(key, value []byte, ttl time.Duration) {
+	wb.ops = append(wb.ops, batchOp{
+		key:   append([]byte(nil), key...),
+		value: append([]byte(nil), value...),
+		mark:  PUT,
+		ttl:   ttl,
+	})
+}
+
+// Delete 暫存一個刪除操作，key 不存在時只會多寫一筆墓碑而不會報錯
+func (wb *WriteBatch) Delete(key []byte) {
+	wb.ops = append(wb.ops, batchOp{
+		key:  append([]byte(nil), key...),
+		mark: DEL,
+	})
+}
+
+// Len 返回批次中暫存的操作數量
+func (wb *WriteBatch) Len() int {
+	return len(wb.ops)
+}
+
+// Reset 清空批次中暫存的操作
+func (wb *WriteBatch) Reset() {
+	wb.ops = wb.ops[:0]
+}
+
+// Commit 將批次中的所有操作作為一個整體寫入，並一次更新索引，
+// 讀取者只會看到整個批次生效前或生效後的狀態。
+func (wb *WriteBatch) Commit() error {
+	if len(wb.ops) == 0 {
+		return nil
+	}
+
+	bc := wb.bc
+	bc.writeMu.Lock()
+	defer bc.writeMu.Unlock()
+
+	if err := bc.checkWritable(); err != nil {
+		return err
+	}
+
+	id := batchSeq.Add(1)
+	now := bc.opts.now()
+
+	begin := NewEntry(nil, encodeBatchBegin(id), BATCH_BEGIN)
+	data, err := begin.Encode()
+	if err != nil {
+		return err
+	}
+
+	offsets := make([]int64, len(wb.ops))
+	entries := make([]*Entry, len(wb.ops))
+	for i, op := range wb.ops {
+		var entry *Entry
+		if op.mark == PUT {
+			if entry, err = bc.newPutEntry(op.key, op.value); err != nil {
+				return err
+			}
+		} else if entry, err = bc.newDeleteEntry(op.key); err != nil {
+			return err
+		}
+		entry.Seq = bc.nextSeq()
+		if op.ttl > 0 {
+			entry.ExpiresAt = now.Add(op.ttl).UnixNano()
+		}
+		buf, err := entry.Encode()
+		if err != nil {
+			return err
+		}
+		offsets[i] = int64(len(data))
+		entries[i] = entry
+		data = append(data, buf...)
+	}
+
+	commit := NewEntry(nil, encodeBatchCommit(id, uint32(len(wb.ops))), BATCH_COMMIT)
+	buf, err := commit.Encode()
+	if err != nil {
+		return err
+	}
+	data = append(data, buf...)
+
+	// 整個批次一次寫入同一個資料段，不會跨越資料段切換
+	fileID, start, err := bc.append(data)
+	if err != nil {
+		return err
+	}
+
+	updates := make([]keyDirUpdate, len(wb.ops))
+	for i, op := range wb.ops {
+		updates[i] = keyDirUpdate{
+			key:    string(op.key),
+			delete: op.mark == DEL,
+			entry:  newKeyDirEntry(fileID, start+offsets[i], entries[i]),
+		}
+	}
+	bc.keyDir.Apply(updates)
+	bc.publish()
+
+	wb.Reset()
+	return nil
+}
+
+// encodeBatchBegin 編碼 BEGIN 標記的 value
+func encodeBatchBegin(id uint64) []byte {
+	buf := make([]byte, batchBeginValueSize)
+	binary.BigEndian.PutUint64(buf, id)
+	return buf
+}
+
+// encodeBatchCommit 編碼 COMMIT 標記的 value
+func encodeBatchCommit(id uint64, count uint32) []byte {
+	buf := make([]byte, batchCommitValueSize)
+	binary.BigEndian.PutUint64(buf[0:8], id)
+	binary.BigEndian.PutUint32(buf[8:12], count)
+	return buf
+}
+
+// batchReplay 在掃描資料段時追蹤批次狀態：批次內的操作先暫存，
+// 直到遇到對應的 COMMIT 標記才一併套用
+type batchReplay struct {
+	apply   func(e *Entry, offset int64)
+	start   int64 // 目前未完成批次的 BEGIN 位置，-1 表示不在批次中
+	id      uint64
+	pending []*Entry
+	offsets []int64
+}
+
+func newBatchReplay(apply func(e *Entry, offset int64)) *batchReplay {
+	return &batchReplay{apply: apply, start: -1}
+}
+
+// add 處理掃描到的一筆 Entry
+func (r *batchReplay) add(e *Entry, offset int64) {
+	switch e.Mark {
+	case BATCH_BEGIN:
+		// 前一個批次沒有 COMMIT 就出現新的 BEGIN，代表前一個批次未完成，直接丟棄
+		r.reset()
+		if len(e.Value) == batchBeginValueSize {
+			r.start = offset
+			r.id = binary.BigEndian.Uint64(e.Value)
+		}
+	case BATCH_COMMIT:
+		if r.start >= 0 && len(e.Value) == batchCommitValueSize &&
+			binary.BigEndian.Uint64(e.Value[0:8]) == r.id &&
+			int(binary.BigEndian.Uint32(e.Value[8:12])) == len(r.pending) {
+			for i, p := range r.pending {
+				r.apply(p, r.offsets[i])
+			}
+		}
+		r.reset()
+	default:
+		if r.start >= 0 {
+			r.pending = append(r.pending, e)
+			r.offsets = append(r.offsets, offset)
+			return
+		}
+		r.apply(e, offset)
+	}
+}
+
+// uncommitted 返回資料段結尾處未完成批次的 BEGIN 位置
+func (r *batchReplay) uncommitted() (int64, bool) {
+	return r.start, r.start >= 0
+}
+
+func (r *batchReplay) reset() {
+	r.start = -1
+	r.id = 0
+	r.pending = nil
+	r.offsets = nil
+}
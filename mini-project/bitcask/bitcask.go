@@ -1,129 +1,653 @@
 package bitcask
 
 import (
-	"encoding/binary"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"sort"
 	"sync"
+	"time"
 )
 
+var (
+	// ErrClosed 表示資料庫已經關閉
+	ErrClosed = errors.New("bitcask is closed")
+	// ErrKeyNotFound 表示 key 不存在；從未寫入、已被刪除或已過期的 key 都返回此錯誤
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrInvalidTTL 表示 PutWithTTL 的存活時間不是正數
+	ErrInvalidTTL = errors.New("invalid ttl")
+)
+
+// Bitcask 的鎖分為三層，需依 mergeMu → writeMu → mu 的順序取得：
+//   - writeMu 串行化所有追加寫入，並保護活躍資料段的大小與落盤計數
+//   - mu 保護資料段集合與關閉狀態，讀取只需持有讀鎖，因此不會被追加寫入阻塞
+//   - mergeMu 確保同一時間只有一個合併在進行
 type Bitcask struct {
-	mu     sync.Mutex
-	file   *os.File
-	keyDir *KeyDir
+	mu        sync.RWMutex
+	writeMu   sync.Mutex
+	mergeMu   sync.Mutex
+	dir       string
+	opts      Options
+	active    *segment            // 目前唯一可寫入的資料段
+	segments  map[uint32]*segment // 已封存、不再寫入的資料段
+	keyDir    *KeyDir
+	codec     *valueCodec // value 的壓縮與加密
+	unsynced  int64       // 活躍資料段中尚未 fsync 的位元組數
+	seq       uint64      // 最後分配的寫入序號，由 writeMu 保護
+	closed    bool
+	lastMerge time.Time      // 最後一次成功合併的時間，由 mu 保護
+	compacted uint32         // 編號小於此值的資料段都經過合併改寫，由 mu 保護
+	tail      *logTail       // 已完成寫入的日誌結尾，供 Watcher 追蹤新的寫入
+	lock      *dirLock       // 資料目錄上的程序鎖，關閉時釋放
+	stopCh    chan struct{}  // 關閉時通知背景工作結束
+	wg        sync.WaitGroup // 等待背景工作結束
 }
 
-func NewBitcask(filename string) (*Bitcask, error) {
-	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+// NewBitcask 開啟（或建立）dir 目錄下的資料庫，編號最大的資料段作為活躍資料段。
+// 開啟時會鎖定資料目錄，目錄已被其他程序開啟時返回包裝 ErrLocked 的 *LockError；
+// 以 WithReadOnly 開啟時只取得共享鎖，可與其他唯讀程序同時開啟。
+func NewBitcask(dir string, opts ...Option) (*Bitcask, error) {
+	options := defaultOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	codec, err := newValueCodec(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		return nil, fmt.Errorf("%w: %s is a single-file database from an older version, convert it with MigrateLegacyFile", ErrFormat, dir)
+	}
+
+	if options.ReadOnly {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, err
+		}
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	lock, err := acquireDirLock(dir, options.ReadOnly)
 	if err != nil {
 		return nil, err
 	}
 
 	bc := &Bitcask{
-		file:   file,
-		keyDir: NewKeyDir(),
+		dir:      dir,
+		opts:     options,
+		segments: make(map[uint32]*segment),
+		keyDir:   newKeyDir(options.now),
+		codec:    codec,
+		lock:     lock,
+		stopCh:   make(chan struct{}),
 	}
 
-	if err := bc.buildIndex(); err != nil {
+	if err := bc.open(); err != nil {
+		bc.closeSegments()
+		lock.release()
 		return nil, err
 	}
+	bc.tail = newLogTail(Position{Segment: bc.active.id, Offset: bc.active.size})
+
+	if options.SweepInterval > 0 {
+		bc.wg.Add(1)
+		go bc.sweepExpired(options.SweepInterval)
+	}
+
+	if options.AutoMerge != nil && !options.ReadOnly {
+		bc.wg.Add(1)
+		go bc.autoMerge(*options.AutoMerge)
+	}
+
+	if options.SyncPolicy == SyncInterval && !options.ReadOnly {
+		bc.wg.Add(1)
+		go bc.syncPeriodically(options.SyncInterval)
+	}
 
 	return bc, nil
 }
 
-func (bc *Bitcask) Put(key, value []byte) error {
-	bc.mu.Lock()
-	defer bc.mu.Unlock()
+// open 在取得目錄鎖之後處理遺留的合併、升級舊格式的資料段、開啟資料段並重建索引
+func (bc *Bitcask) open() error {
+	var upgraded uint32
+	if !bc.opts.ReadOnly {
+		if err := recoverMerge(bc.dir); err != nil {
+			return err
+		}
+		var err error
+		if upgraded, err = upgradeSegments(bc.dir); err != nil {
+			return err
+		}
+	} else if fileExists(filepath.Join(bc.dir, mergeDirName, mergeFinishedName)) {
+		// 已完成但尚未替換的合併需要寫入才能完成，唯讀模式下無法得到一致的資料段集合
+		return fmt.Errorf("unfinished merge in %s must be recovered by a read-write open", bc.dir)
+	}
 
-	entry := NewEntry(key, value, PUT)
-	data, err := entry.Encode()
-	if err != nil {
+	if err := bc.openSegments(); err != nil {
+		return err
+	}
+	// 升級改變了 Entry 的偏移量，升級前的日誌位置都視為已被改寫
+	bc.compacted = max(bc.compacted, upgraded)
+	if err := bc.buildIndex(); err != nil {
 		return err
 	}
 
-	offset, err := bc.file.Seek(0, io.SeekEnd)
+	// 合併會丟棄墓碑，日誌中的最大序號可能小於曾經分配過的序號；
+	// 以目前時間作為下限，避免刪除後重新建立的 key 重複使用舊的版本號
+	bc.seq = max(bc.seq, uint64(time.Now().UnixNano()))
+	return nil
+}
+
+// openSegments 開啟目錄中既有的資料段，沒有任何資料段時建立第一個
+func (bc *Bitcask) openSegments() error {
+	ids, err := listSegmentIDs(bc.dir)
 	if err != nil {
 		return err
 	}
 
-	if _, err := bc.file.Write(data); err != nil {
-		return err
+	flag := os.O_RDWR | os.O_CREATE
+	if bc.opts.ReadOnly {
+		if len(ids) == 0 {
+			return fmt.Errorf("no data files in %s", bc.dir)
+		}
+		flag = os.O_RDONLY
+	}
+
+	if len(ids) == 0 {
+		ids = []uint32{0}
 	}
 
-	bc.keyDir.Put(string(key), offset)
+	for i, id := range ids {
+		seg, err := openSegmentFile(bc.dir, id, flag)
+		if err != nil {
+			return err
+		}
+		// 只有合併產生的資料段有提示檔
+		if fileExists(hintPath(bc.dir, id)) {
+			bc.compacted = id + 1
+		}
+		if i == len(ids)-1 {
+			bc.active = seg
+		} else {
+			bc.segments[id] = seg
+		}
+	}
 	return nil
 }
 
+func (bc *Bitcask) Put(key, value []byte) error {
+	return bc.put(key, value, 0)
+}
+
+// PutWithTTL 寫入一個在 ttl 之後過期的鍵值對，過期後 Get 與 ListKeys 都看不到該 key
+func (bc *Bitcask) PutWithTTL(key, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("%w %v", ErrInvalidTTL, ttl)
+	}
+	return bc.put(key, value, bc.opts.now().Add(ttl).UnixNano())
+}
+
+// put 寫入鍵值對，expiresAt 為 0 表示永不過期
+func (bc *Bitcask) put(key, value []byte, expiresAt int64) error {
+	bc.writeMu.Lock()
+	defer bc.writeMu.Unlock()
+
+	if err := bc.checkWritable(); err != nil {
+		return err
+	}
+	_, err := bc.putLocked(key, value, expiresAt)
+	return err
+}
+
+// putLocked 寫入鍵值對並返回新的版本號，呼叫前需持有 writeMu 並確認可寫入
+func (bc *Bitcask) putLocked(key, value []byte, expiresAt int64) (uint64, error) {
+	entry, err := bc.newPutEntry(key, value)
+	if err != nil {
+		return 0, err
+	}
+	entry.ExpiresAt = expiresAt
+	entry.Seq = bc.nextSeq()
+	data, err := entry.Encode()
+	if err != nil {
+		return 0, err
+	}
+
+	fileID, offset, err := bc.append(data)
+	if err != nil {
+		return 0, err
+	}
+
+	bc.keyDir.Put(string(key), newKeyDirEntry(fileID, offset, entry))
+	bc.publish()
+	return entry.Seq, nil
+}
+
+// nextSeq 分配下一個寫入序號，呼叫前需持有 writeMu
+func (bc *Bitcask) nextSeq() uint64 {
+	bc.seq++
+	return bc.seq
+}
+
+// Get 取得 key 的最新值。預設依索引中的位置以一次 ReadAt 只讀出 value 本身；
+// 設定 WithVerifyChecksum 時改為讀出整筆 Entry 並校驗 CRC。
+// 讀取只持有讀鎖，可與其他讀取及追加寫入並行。
 func (bc *Bitcask) Get(key []byte) ([]byte, error) {
-	bc.mu.Lock()
-	defer bc.mu.Unlock()
+	return bc.get(key, bc.opts.VerifyChecksum)
+}
+
+// GetVerified 取得 key 的最新值並一律校驗 CRC，適合需要按需確認資料完整性的場合
+func (bc *Bitcask) GetVerified(key []byte) ([]byte, error) {
+	return bc.get(key, true)
+}
+
+func (bc *Bitcask) get(key []byte, verify bool) ([]byte, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if bc.closed {
+		return nil, ErrClosed
+	}
 
-	offset, exists := bc.keyDir.Get(string(key))
+	pos, exists := bc.keyDir.Get(string(key))
 	if !exists {
-		return nil, fmt.Errorf("key not found")
+		return nil, ErrKeyNotFound
 	}
 
-	if _, err := bc.file.Seek(offset, io.SeekStart); err != nil {
-		return nil, err
+	return readValue(bc.segment(pos.FileID), bc.codec, key, pos, verify)
+}
+
+// readValue 依索引位置從資料段讀出 key 的值並依旗標解密與解壓縮，verify 為 true 時讀出整筆 Entry 並校驗 CRC
+func readValue(seg *segment, codec *valueCodec, key []byte, pos KeyDirEntry, verify bool) ([]byte, error) {
+	if seg == nil {
+		return nil, fmt.Errorf("segment %d not found", pos.FileID)
 	}
 
-	buf := make([]byte, entryHeaderSize)
-	if _, err := io.ReadFull(bc.file, buf); err != nil {
-		return nil, err
+	if verify {
+		entry, err := readVerifiedEntry(seg, codec, key, pos)
+		if err != nil {
+			return nil, err
+		}
+		return codec.decode(key, entry.Flags, entry.KeyID, entry.Value)
 	}
 
-	ks := binary.BigEndian.Uint32(buf[0:4])
-	vs := binary.BigEndian.Uint32(buf[4:8])
-	buf = append(buf, make([]byte, ks+vs)...)
-	if _, err := io.ReadFull(bc.file, buf[entryHeaderSize:]); err != nil {
+	value := make([]byte, pos.ValueSize)
+	if _, err := seg.file.ReadAt(value, pos.ValuePos); err != nil {
+		if err == io.EOF {
+			return nil, &ErrCorrupt{Segment: seg.id, Offset: pos.ValuePos, Err: io.ErrUnexpectedEOF}
+		}
 		return nil, err
 	}
+	return codec.decode(key, pos.Flags, pos.KeyID, value)
+}
 
-	entry, err := Decode(buf)
+// readVerifiedEntry 依索引位置讀出整筆 Entry，校驗 CRC 並確認解密後的 key 相符
+func readVerifiedEntry(seg *segment, codec *valueCodec, key []byte, pos KeyDirEntry) (*Entry, error) {
+	offset := pos.entryOffset(len(key))
+	entry, err := seg.readEntry(offset, pos.ValuePos+int64(pos.ValueSize))
 	if err != nil {
 		return nil, err
 	}
+	stored, err := codec.entryKey(entry)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(stored, key) {
+		return nil, &ErrCorrupt{Segment: seg.id, Offset: offset, Err: errKeyMismatch}
+	}
+	return entry, nil
+}
+
+// GetWithCRC 取得 key 的最新值與該筆 Entry 的 CRC，並一律校驗 CRC。
+// CRC 涵蓋整筆 Entry 包含寫入時間與序號，每次寫入都不同，可作為值是否改變的識別，例如 HTTP 的 ETag。
+func (bc *Bitcask) GetWithCRC(key []byte) ([]byte, uint32, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if bc.closed {
+		return nil, 0, ErrClosed
+	}
 
-	if entry.Mark == DEL {
-		return nil, fmt.Errorf("key has been deleted")
+	pos, exists := bc.keyDir.Get(string(key))
+	if !exists {
+		return nil, 0, ErrKeyNotFound
 	}
 
-	return entry.Value, nil
+	seg := bc.segment(pos.FileID)
+	if seg == nil {
+		return nil, 0, fmt.Errorf("segment %d not found", pos.FileID)
+	}
+	entry, err := readVerifiedEntry(seg, bc.codec, key, pos)
+	if err != nil {
+		return nil, 0, err
+	}
+	value, err := bc.codec.decode(key, entry.Flags, entry.KeyID, entry.Value)
+	if err != nil {
+		return nil, 0, err
+	}
+	return value, entry.CRC, nil
 }
 
 func (bc *Bitcask) Delete(key []byte) error {
-	bc.mu.Lock()
-	defer bc.mu.Unlock()
+	bc.writeMu.Lock()
+	defer bc.writeMu.Unlock()
+
+	if err := bc.checkWritable(); err != nil {
+		return err
+	}
 
 	if _, exists := bc.keyDir.Get(string(key)); !exists {
-		return fmt.Errorf("key not found")
+		return ErrKeyNotFound
 	}
+	return bc.deleteLocked(key)
+}
 
-	entry := NewEntry(key, nil, DEL)
+// deleteLocked 寫入 key 的墓碑並從索引移除，呼叫前需持有 writeMu 並確認可寫入
+func (bc *Bitcask) deleteLocked(key []byte) error {
+	entry, err := bc.newDeleteEntry(key)
+	if err != nil {
+		return err
+	}
+	entry.Seq = bc.nextSeq()
 	data, err := entry.Encode()
 	if err != nil {
 		return err
 	}
 
-	if _, err := bc.file.Seek(0, io.SeekEnd); err != nil {
+	if _, _, err := bc.append(data); err != nil {
 		return err
 	}
-	if _, err := bc.file.Write(data); err != nil {
+
+	bc.keyDir.Delete(string(key))
+	bc.publish()
+	return nil
+}
+
+// ListKeys 返回所有尚未過期的 key
+func (bc *Bitcask) ListKeys() []string {
+	return bc.keyDir.ListKeys()
+}
+
+// Sync 將活躍資料段中尚未落盤的資料 fsync 到磁碟，唯讀模式下沒有需要落盤的資料
+func (bc *Bitcask) Sync() error {
+	bc.writeMu.Lock()
+	defer bc.writeMu.Unlock()
+
+	if bc.closed {
+		return ErrClosed
+	}
+	if bc.opts.ReadOnly {
+		return nil
+	}
+	return bc.sync()
+}
+
+// checkWritable 確認資料庫目前可以寫入，呼叫前需持有 writeMu
+func (bc *Bitcask) checkWritable() error {
+	if bc.closed {
+		return ErrClosed
+	}
+	if bc.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// sync 對活躍資料段呼叫 fsync，呼叫前需持有 writeMu
+func (bc *Bitcask) sync() error {
+	if err := bc.active.file.Sync(); err != nil {
 		return err
 	}
+	bc.unsynced = 0
+	return nil
+}
 
-	bc.keyDir.Delete(string(key))
+// Close 停止背景工作、將資料落盤、關閉所有資料段檔案並釋放目錄鎖，重複呼叫不會有任何效果。
+// 進行中的合併會被中止，Close 等它結束後才釋放目錄鎖，避免合併在其他程序開啟目錄後仍在改動檔案。
+func (bc *Bitcask) Close() error {
+	bc.writeMu.Lock()
+	bc.mu.Lock()
+	if bc.closed {
+		bc.mu.Unlock()
+		bc.writeMu.Unlock()
+		return nil
+	}
+	bc.closed = true
+	close(bc.stopCh)
+	bc.mu.Unlock()
+	bc.writeMu.Unlock()
+
+	// 自動合併以 TryLock 取得 mergeMu，持有 mergeMu 等待背景工作不會死結
+	bc.mergeMu.Lock()
+	defer bc.mergeMu.Unlock()
+	bc.wg.Wait()
+
+	bc.writeMu.Lock()
+	defer bc.writeMu.Unlock()
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	var syncErr error
+	if !bc.opts.ReadOnly {
+		syncErr = bc.sync()
+	}
+	closeErr := bc.closeSegments()
+	lockErr := bc.lock.release()
+	for _, err := range []error{closeErr, syncErr, lockErr} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncPeriodically 在 SyncInterval 策略下定期將資料落盤
+func (bc *Bitcask) syncPeriodically(interval time.Duration) {
+	defer bc.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-bc.stopCh:
+			return
+		case <-ticker.C:
+			bc.writeMu.Lock()
+			if bc.unsynced > 0 {
+				bc.sync()
+			}
+			bc.writeMu.Unlock()
+		}
+	}
+}
+
+// sweepExpired 定期從索引中移除已過期的 key，不需等到讀取時才發現
+func (bc *Bitcask) sweepExpired(interval time.Duration) {
+	defer bc.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-bc.stopCh:
+			return
+		case <-ticker.C:
+			bc.keyDir.RemoveExpired(bc.opts.now().UnixNano())
+		}
+	}
+}
+
+// append 將編碼後的資料寫入活躍資料段的尾端，必要時先切換資料段，
+// 返回寫入的資料段編號與偏移量，呼叫前需持有 writeMu
+func (bc *Bitcask) append(data []byte) (uint32, int64, error) {
+	if err := bc.reserve(int64(len(data))); err != nil {
+		return 0, 0, err
+	}
+
+	offset := bc.active.size
+	n, err := bc.active.file.WriteAt(data, offset)
+	bc.active.size = offset + int64(n)
+	bc.unsynced += int64(n)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := bc.maybeSync(); err != nil {
+		return 0, 0, err
+	}
+
+	return bc.active.id, offset, nil
+}
+
+// reserve 確保活躍資料段還能寫入 n 個位元組，放不下時切換到新的資料段；
+// 空的資料段一定可以寫入，因此超過大小上限的單筆 Entry 會獨佔一個資料段
+func (bc *Bitcask) reserve(n int64) error {
+	if !bc.active.empty() && bc.active.size+n > bc.opts.MaxFileSize {
+		return bc.rotate()
+	}
 	return nil
 }
 
-func (bc *Bitcask) Merge() error {
-	// 合併邏輯和上面的 Merge 邏輯基本保持一致
+// maybeSync 依落盤策略決定寫入後是否需要 fsync，呼叫前需持有 writeMu
+func (bc *Bitcask) maybeSync() error {
+	switch bc.opts.SyncPolicy {
+	case SyncAlways:
+		return bc.sync()
+	case SyncBytes:
+		if bc.unsynced >= bc.opts.SyncBytes {
+			return bc.sync()
+		}
+	}
+	return nil
+}
+
+// rotate 封存目前的活躍資料段並開啟下一個編號的新資料段。
+// 呼叫前需持有 writeMu，切換資料段集合時才短暫取得 mu。
+func (bc *Bitcask) rotate() error {
+	if err := bc.sync(); err != nil {
+		return err
+	}
+
+	next, err := openSegment(bc.dir, bc.active.id+1)
+	if err != nil {
+		return err
+	}
+
+	bc.mu.Lock()
+	bc.segments[bc.active.id] = bc.active
+	bc.active = next
+	bc.mu.Unlock()
+	bc.publish()
 	return nil
 }
 
-// buildIndex 構建內存索引
+// segment 返回指定編號的資料段，呼叫前需持有 mu 的讀鎖或寫鎖
+func (bc *Bitcask) segment(id uint32) *segment {
+	if bc.active != nil && bc.active.id == id {
+		return bc.active
+	}
+	return bc.segments[id]
+}
+
+// closeSegments 釋放所有已開啟的資料段，並返回遇到的第一個錯誤。
+// 仍被快照引用的資料段要等快照釋放後才會真正關閉。
+func (bc *Bitcask) closeSegments() error {
+	var firstErr error
+	for id, seg := range bc.segments {
+		if err := seg.release(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(bc.segments, id)
+	}
+	if bc.active != nil {
+		if err := bc.active.release(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		bc.active = nil
+	}
+	return firstErr
+}
+
+// buildIndex 依編號順序載入提示檔或掃描資料段以重建內存索引。
+// 活躍資料段尾端若有寫到一半或 CRC 錯誤的資料，會截斷回最後一筆有效的 Entry，
+// 尾端未提交的批次也一併截斷；唯讀模式下不修改檔案，只忽略這段尾端。
+// 封存的資料段不應該損壞，遇到錯誤時直接返回。
 func (bc *Bitcask) buildIndex() error {
-	// 和之前的 buildIndex 基本保持一致
+	ids := make([]uint32, 0, len(bc.segments))
+	for id := range bc.segments {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	segs := make([]*segment, 0, len(ids)+1)
+	for _, id := range ids {
+		segs = append(segs, bc.segments[id])
+	}
+	segs = append(segs, bc.active)
+
+	now := bc.opts.now().UnixNano()
+	for _, seg := range segs {
+		// 合併產生的資料段有提示檔，可以不讀 value 直接載入索引
+		if seg != bc.active && bc.loadHint(seg) {
+			continue
+		}
+
+		// 加密的 key 無法解密時無法建立索引，記錄第一個錯誤並在掃描後返回
+		var keyErr error
+		replay := newBatchReplay(func(e *Entry, offset int64) {
+			if e.Mark != PUT && e.Mark != DEL {
+				return
+			}
+			key, err := bc.codec.entryKey(e)
+			if err != nil {
+				if keyErr == nil {
+					keyErr = fmt.Errorf("error decrypting key in segment %d at offset %d: %w", seg.id, offset, err)
+				}
+				return
+			}
+			if e.Mark == DEL || e.IsExpired(now) {
+				bc.keyDir.Delete(string(key))
+				return
+			}
+			bc.keyDir.Put(string(key), newKeyDirEntry(seg.id, offset, e))
+		})
+
+		end, err := seg.scan(func(e *Entry, offset int64) {
+			bc.seq = max(bc.seq, e.Seq)
+			replay.add(e, offset)
+		})
+		if keyErr != nil {
+			return keyErr
+		}
+		if err != nil && seg != bc.active {
+			return &ErrCorrupt{Segment: seg.id, Offset: end, Err: err}
+		}
+
+		if seg != bc.active {
+			continue
+		}
+
+		// 尾端未提交的批次從 BEGIN 標記處一併截斷
+		if start, ok := replay.uncommitted(); ok {
+			end = start
+		}
+		if end == seg.size {
+			continue
+		}
+		if bc.opts.ReadOnly {
+			seg.size = end
+			continue
+		}
+
+		if err := seg.truncate(end); err != nil {
+			return fmt.Errorf("error truncating segment %d: %v", seg.id, err)
+		}
+	}
 	return nil
 }
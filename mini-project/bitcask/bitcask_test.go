@@ -0,0 +1,1979 @@
+package bitcask
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openTestBitcask 在暫存目錄中開啟一個資料庫，測試結束時自動關閉
+func openTestBitcask(t *testing.T, dir string, opts ...Option) *Bitcask {
+	t.Helper()
+	bc, err := NewBitcask(dir, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { bc.Close() })
+	return bc
+}
+
+// fakeClock 為測試用的時鐘，只有呼叫 Advance 時才會前進
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Now()}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestPutGetDelete(t *testing.T) {
+	bc := openTestBitcask(t, t.TempDir())
+
+	require.NoError(t, bc.Put([]byte("name"), []byte("Alice")))
+	value, err := bc.Get([]byte("name"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("Alice"), value)
+
+	require.NoError(t, bc.Put([]byte("name"), []byte("Bob")))
+	value, err = bc.Get([]byte("name"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("Bob"), value)
+
+	require.NoError(t, bc.Delete([]byte("name")))
+	_, err = bc.Get([]byte("name"))
+	assert.Error(t, err)
+	assert.Error(t, bc.Delete([]byte("name")))
+}
+
+func TestSegmentRotation(t *testing.T) {
+	dir := t.TempDir()
+	bc := openTestBitcask(t, dir, WithMaxFileSize(128))
+
+	for i := 0; i < 50; i++ {
+		key := []byte(fmt.Sprintf("key-%02d", i))
+		require.NoError(t, bc.Put(key, []byte(fmt.Sprintf("value-%02d", i))))
+	}
+
+	ids, err := listSegmentIDs(dir)
+	require.NoError(t, err)
+	assert.Greater(t, len(ids), 1)
+
+	for _, id := range ids[:len(ids)-1] {
+		assert.LessOrEqual(t, bc.segments[id].size, int64(128))
+	}
+
+	for i := 0; i < 50; i++ {
+		value, err := bc.Get([]byte(fmt.Sprintf("key-%02d", i)))
+		require.NoError(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("value-%02d", i)), value)
+	}
+
+	pos, ok := bc.keyDir.Get("key-00")
+	require.True(t, ok)
+	assert.Equal(t, ids[0], pos.FileID)
+}
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	bc := openTestBitcask(t, dir, WithMaxFileSize(256))
+
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 20; i++ {
+			key := []byte(fmt.Sprintf("key-%02d", i))
+			require.NoError(t, bc.Put(key, []byte(fmt.Sprintf("value-%02d-%d", i, round))))
+		}
+	}
+	for i := 0; i < 10; i++ {
+		require.NoError(t, bc.Delete([]byte(fmt.Sprintf("key-%02d", i))))
+	}
+
+	before, err := listSegmentIDs(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, bc.Merge())
+
+	after, err := listSegmentIDs(dir)
+	require.NoError(t, err)
+	assert.Less(t, len(after), len(before))
+	assert.NoDirExists(t, filepath.Join(dir, mergeDirName))
+
+	for i := 0; i < 20; i++ {
+		value, err := bc.Get([]byte(fmt.Sprintf("key-%02d", i)))
+		if i < 10 {
+			assert.Error(t, err)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("value-%02d-4", i)), value)
+	}
+
+	// 合併後重新開啟，索引應與合併前一致
+	require.NoError(t, bc.Close())
+	bc = openTestBitcask(t, dir, WithMaxFileSize(256))
+	assert.Len(t, bc.keyDir.ListKeys(), 10)
+	value, err := bc.Get([]byte("key-19"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value-19-4"), value)
+}
+
+func TestMergeWithConcurrentWrites(t *testing.T) {
+	bc := openTestBitcask(t, t.TempDir(), WithMaxFileSize(512))
+
+	for i := 0; i < 200; i++ {
+		require.NoError(t, bc.Put([]byte(fmt.Sprintf("key-%03d", i)), []byte("old")))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			assert.NoError(t, bc.Put([]byte(fmt.Sprintf("key-%03d", i)), []byte("new")))
+		}
+	}()
+
+	require.NoError(t, bc.Merge())
+	wg.Wait()
+
+	for i := 0; i < 200; i++ {
+		value, err := bc.Get([]byte(fmt.Sprintf("key-%03d", i)))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("new"), value)
+	}
+}
+
+func TestMergeKeepsReadersOpen(t *testing.T) {
+	bc := openTestBitcask(t, t.TempDir(), WithMaxFileSize(256))
+	for i := 0; i < 20; i++ {
+		require.NoError(t, bc.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte(fmt.Sprintf("old-%02d", i))))
+	}
+
+	snap, err := bc.Snapshot()
+	require.NoError(t, err)
+	defer snap.Release()
+	it := snap.NewIterator(IteratorOptions{})
+	r, err := bc.GetReader([]byte("key-05"))
+	require.NoError(t, err)
+	defer r.Close()
+
+	// 兩次合併後，快照與 Reader 引用的資料段都已從目錄中刪除，但檔案仍保持開啟
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 20; i++ {
+			require.NoError(t, bc.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte(fmt.Sprintf("new-%02d", i))))
+		}
+		require.NoError(t, bc.Merge())
+	}
+
+	n := 0
+	for ; it.Valid(); it.Next() {
+		value, err := it.Value()
+		require.NoError(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("old-%02d", n)), value)
+		n++
+	}
+	assert.Equal(t, 20, n)
+
+	value, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("old-05"), value)
+
+	value, err = bc.Get([]byte("key-05"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("new-05"), value)
+}
+
+func TestMergeInstallFailure(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := NewBitcask(dir, WithMaxFileSize(256))
+	require.NoError(t, err)
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 20; i++ {
+			require.NoError(t, bc.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte(fmt.Sprintf("value-%02d-%d", i, round))))
+		}
+	}
+	for i := 0; i < 5; i++ {
+		require.NoError(t, bc.Delete([]byte(fmt.Sprintf("key-%02d", i))))
+	}
+
+	// 在第一個輸出資料段的提示檔位置放一個非空目錄，讓替換在刪除部分舊資料段之後失敗
+	blocker := hintPath(dir, 0)
+	require.NoError(t, os.MkdirAll(filepath.Join(blocker, "x"), 0755))
+
+	check := func(bc *Bitcask) {
+		t.Helper()
+		for i := 0; i < 20; i++ {
+			value, err := bc.Get([]byte(fmt.Sprintf("key-%02d", i)))
+			if i < 5 {
+				assert.ErrorIs(t, err, ErrKeyNotFound)
+				continue
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []byte(fmt.Sprintf("value-%02d-2", i)), value)
+		}
+	}
+
+	err = bc.Merge()
+	require.ErrorIs(t, err, ErrMergePending)
+	check(bc)
+
+	// 替換完成前不能再合併，否則會捨棄合併目錄中唯一的副本
+	assert.ErrorIs(t, bc.Merge(), ErrMergePending)
+	assert.FileExists(t, filepath.Join(dir, mergeDirName, mergeFinishedName))
+	require.NoError(t, bc.Put([]byte("after"), []byte("failure")))
+	require.NoError(t, bc.Close())
+
+	// 重新開啟時完成替換，資料都沒有遺失
+	require.NoError(t, os.RemoveAll(blocker))
+	bc = openTestBitcask(t, dir, WithMaxFileSize(256))
+	assert.NoDirExists(t, filepath.Join(dir, mergeDirName))
+	check(bc)
+	value, err := bc.Get([]byte("after"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("failure"), value)
+	require.NoError(t, bc.Merge())
+	check(bc)
+}
+
+func TestCloseWaitsForMerge(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := NewBitcask(dir, WithMaxFileSize(4096))
+	require.NoError(t, err)
+	for i := 0; i < 20000; i++ {
+		require.NoError(t, bc.Put([]byte(fmt.Sprintf("key-%05d", i)), bytes.Repeat([]byte("v"), 64)))
+	}
+
+	// 等到合併開始寫入暫存目錄後才關閉
+	done := make(chan error, 1)
+	go func() { done <- bc.Merge() }()
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, mergeDirName))
+		return err == nil
+	}, 5*time.Second, 100*time.Microsecond)
+	require.NoError(t, bc.Close())
+
+	// Close 返回時合併已經結束，不會在之後改動資料目錄
+	select {
+	case err := <-done:
+		if err != nil {
+			assert.ErrorIs(t, err, ErrClosed)
+		}
+	default:
+		t.Fatal("Close returned before Merge finished")
+	}
+	assert.NoDirExists(t, filepath.Join(dir, mergeDirName))
+	assert.ErrorIs(t, bc.Merge(), ErrClosed)
+
+	bc = openTestBitcask(t, dir)
+	assert.Equal(t, 20000, bc.keyDir.Len())
+}
+
+func TestRecoverInterruptedMerge(t *testing.T) {
+	dir := t.TempDir()
+	mergeDir := filepath.Join(dir, mergeDirName)
+	require.NoError(t, os.MkdirAll(mergeDir, 0755))
+
+	for _, id := range []uint32{0, 1, 2} {
+		require.NoError(t, os.WriteFile(segmentPath(dir, id), []byte("old"), 0644))
+	}
+	require.NoError(t, os.WriteFile(segmentPath(mergeDir, 0), []byte("merged"), 0644))
+	require.NoError(t, writeMergeFinished(mergeDir, 2, []uint32{0}))
+
+	require.NoError(t, recoverMerge(dir))
+
+	ids, err := listSegmentIDs(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{0, 2}, ids)
+	data, err := os.ReadFile(segmentPath(dir, 0))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("merged"), data)
+	assert.NoDirExists(t, mergeDir)
+}
+
+func TestReopenRebuildsIndex(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := NewBitcask(dir, WithMaxFileSize(128))
+	require.NoError(t, err)
+
+	for i := 0; i < 30; i++ {
+		require.NoError(t, bc.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte(fmt.Sprintf("value-%02d", i))))
+	}
+	require.NoError(t, bc.Put([]byte("key-00"), []byte("updated")))
+	require.NoError(t, bc.Delete([]byte("key-01")))
+	require.NoError(t, bc.Close())
+
+	bc = openTestBitcask(t, dir, WithMaxFileSize(128))
+
+	value, err := bc.Get([]byte("key-00"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("updated"), value)
+
+	_, err = bc.Get([]byte("key-01"))
+	assert.Error(t, err)
+
+	for i := 2; i < 30; i++ {
+		value, err := bc.Get([]byte(fmt.Sprintf("key-%02d", i)))
+		require.NoError(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("value-%02d", i)), value)
+	}
+}
+
+func TestReopenTruncatesTornTail(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := NewBitcask(dir)
+	require.NoError(t, err)
+	require.NoError(t, bc.Put([]byte("a"), []byte("1")))
+	require.NoError(t, bc.Put([]byte("b"), []byte("2")))
+	validSize := bc.active.size
+	require.NoError(t, bc.Close())
+
+	// 模擬寫到一半就當機的 Entry
+	file, err := os.OpenFile(segmentPath(dir, 0), os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	data, err := NewEntry([]byte("c"), []byte("3"), PUT).Encode()
+	require.NoError(t, err)
+	_, err = file.Write(data[:len(data)-1])
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	bc = openTestBitcask(t, dir)
+	assert.Equal(t, validSize, bc.active.size)
+
+	value, err := bc.Get([]byte("b"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("2"), value)
+
+	info, err := os.Stat(segmentPath(dir, 0))
+	require.NoError(t, err)
+	assert.Equal(t, validSize, info.Size())
+}
+
+func TestReopenTruncatesCorruptTail(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := NewBitcask(dir)
+	require.NoError(t, err)
+	require.NoError(t, bc.Put([]byte("a"), []byte("1")))
+	validSize := bc.active.size
+	require.NoError(t, bc.Put([]byte("b"), []byte("2")))
+	require.NoError(t, bc.Close())
+
+	// 翻轉最後一筆 Entry 的 value，讓 CRC 校驗失敗
+	path := segmentPath(dir, 0)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	bc = openTestBitcask(t, dir)
+	assert.Equal(t, validSize, bc.active.size)
+
+	value, err := bc.Get([]byte("a"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+
+	_, err = bc.Get([]byte("b"))
+	assert.Error(t, err)
+}
+
+func TestHintFiles(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := NewBitcask(dir, WithMaxFileSize(256))
+	require.NoError(t, err)
+	for i := 0; i < 40; i++ {
+		require.NoError(t, bc.Put([]byte(fmt.Sprintf("key-%02d", i%20)), []byte(fmt.Sprintf("value-%02d", i))))
+	}
+	require.NoError(t, bc.Merge())
+	require.NoError(t, bc.Close())
+
+	ids, err := listSegmentIDs(dir)
+	require.NoError(t, err)
+	for _, id := range ids[:len(ids)-1] {
+		assert.FileExists(t, hintPath(dir, id))
+	}
+
+	check := func() {
+		bc := openTestBitcask(t, dir, WithMaxFileSize(256))
+		assert.Len(t, bc.keyDir.ListKeys(), 20)
+		for i := 20; i < 40; i++ {
+			value, err := bc.Get([]byte(fmt.Sprintf("key-%02d", i%20)))
+			require.NoError(t, err)
+			assert.Equal(t, []byte(fmt.Sprintf("value-%02d", i)), value)
+		}
+		require.NoError(t, bc.Close())
+	}
+
+	// 提示檔完好時直接由提示檔載入
+	check()
+
+	// 提示檔損壞時退回完整掃描
+	path := hintPath(dir, ids[0])
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	check()
+
+	// 提示檔遺失時同樣退回完整掃描
+	require.NoError(t, os.Remove(path))
+	check()
+}
+
+func TestPutWithTTL(t *testing.T) {
+	dir := t.TempDir()
+	clock := newFakeClock()
+	bc := openTestBitcask(t, dir, WithSweepInterval(0), withClock(clock.Now))
+
+	require.NoError(t, bc.PutWithTTL([]byte("session"), []byte("token"), time.Minute))
+	require.NoError(t, bc.Put([]byte("forever"), []byte("value")))
+	assert.Error(t, bc.PutWithTTL([]byte("bad"), []byte("ttl"), 0))
+
+	value, err := bc.Get([]byte("session"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("token"), value)
+	assert.ElementsMatch(t, []string{"session", "forever"}, bc.ListKeys())
+
+	clock.Advance(time.Minute - time.Nanosecond)
+	_, err = bc.Get([]byte("session"))
+	require.NoError(t, err)
+	clock.Advance(time.Nanosecond)
+
+	_, err = bc.Get([]byte("session"))
+	assert.Error(t, err)
+	assert.Equal(t, []string{"forever"}, bc.ListKeys())
+
+	// 合併會丟棄已過期的資料，重新開啟後也不會再出現
+	require.NoError(t, bc.Merge())
+	require.NoError(t, bc.Close())
+	bc = openTestBitcask(t, dir, WithSweepInterval(0), withClock(clock.Now))
+	_, ok := bc.keyDir.snapshot().get("session")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"forever"}, bc.ListKeys())
+}
+
+func TestSweepExpired(t *testing.T) {
+	bc := openTestBitcask(t, t.TempDir(), WithSweepInterval(10*time.Millisecond))
+
+	require.NoError(t, bc.PutWithTTL([]byte("session"), []byte("token"), 20*time.Millisecond))
+	require.NoError(t, bc.Put([]byte("forever"), []byte("value")))
+
+	assert.Eventually(t, func() bool {
+		bc.keyDir.mu.RLock()
+		defer bc.keyDir.mu.RUnlock()
+		_, ok := bc.keyDir.snapshot().get("session")
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+
+	value, err := bc.Get([]byte("forever"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value"), value)
+}
+
+func TestWriteBatch(t *testing.T) {
+	dir := t.TempDir()
+	bc := openTestBitcask(t, dir)
+	require.NoError(t, bc.Put([]byte("a"), []byte("old")))
+
+	wb := bc.NewWriteBatch()
+	wb.Put([]byte("a"), []byte("1"))
+	wb.Put([]byte("b"), []byte("2"))
+	wb.Delete([]byte("c"))
+	assert.Equal(t, 3, wb.Len())
+
+	// Commit 之前批次內容不可見
+	value, err := bc.Get([]byte("a"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("old"), value)
+	_, err = bc.Get([]byte("b"))
+	assert.Error(t, err)
+
+	require.NoError(t, wb.Commit())
+	assert.Equal(t, 0, wb.Len())
+
+	check := func(bc *Bitcask) {
+		value, err := bc.Get([]byte("a"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("1"), value)
+		value, err = bc.Get([]byte("b"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("2"), value)
+	}
+	check(bc)
+
+	require.NoError(t, bc.Close())
+	check(openTestBitcask(t, dir))
+}
+
+func TestWriteBatchTTLStartsAtCommit(t *testing.T) {
+	clock := newFakeClock()
+	bc := openTestBitcask(t, t.TempDir(), WithSweepInterval(0), withClock(clock.Now))
+
+	wb := bc.NewWriteBatch()
+	require.NoError(t, wb.PutWithTTL([]byte("session"), []byte("token"), time.Minute))
+	assert.ErrorIs(t, wb.PutWithTTL([]byte("bad"), []byte("ttl"), 0), ErrInvalidTTL)
+
+	// 暫存之後超過 ttl 才 Commit，存活時間從 Commit 時開始計算
+	clock.Advance(2 * time.Minute)
+	require.NoError(t, wb.Commit())
+	value, err := bc.Get([]byte("session"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("token"), value)
+
+	clock.Advance(time.Minute)
+	_, err = bc.Get([]byte("session"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestUncommittedBatchIgnoredOnRecovery(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := NewBitcask(dir)
+	require.NoError(t, err)
+	require.NoError(t, bc.Put([]byte("a"), []byte("1")))
+	validSize := bc.active.size
+
+	wb := bc.NewWriteBatch()
+	wb.Put([]byte("a"), []byte("2"))
+	wb.Put([]byte("b"), []byte("2"))
+	require.NoError(t, wb.Commit())
+	require.NoError(t, bc.Close())
+
+	// 去掉 COMMIT 標記，模擬批次寫到一半就當機
+	path := segmentPath(dir, 0)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	commitSize := entryHeaderSize + batchCommitValueSize
+	require.NoError(t, os.WriteFile(path, data[:len(data)-commitSize], 0644))
+
+	bc = openTestBitcask(t, dir)
+	assert.Equal(t, validSize, bc.active.size)
+
+	value, err := bc.Get([]byte("a"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+	_, err = bc.Get([]byte("b"))
+	assert.Error(t, err)
+
+	// 截斷後繼續寫入的資料在下次開啟時不受影響
+	require.NoError(t, bc.Put([]byte("c"), []byte("3")))
+	require.NoError(t, bc.Close())
+	bc = openTestBitcask(t, dir)
+	value, err = bc.Get([]byte("c"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("3"), value)
+}
+
+func TestSyncPolicies(t *testing.T) {
+	t.Run("always", func(t *testing.T) {
+		bc := openTestBitcask(t, t.TempDir(), WithSyncAlways())
+		require.NoError(t, bc.Put([]byte("a"), []byte("1")))
+		assert.Zero(t, bc.unsynced)
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		bc := openTestBitcask(t, t.TempDir(), WithSyncBytes(100))
+		require.NoError(t, bc.Put([]byte("a"), []byte("1")))
+		assert.NotZero(t, bc.unsynced)
+		require.NoError(t, bc.Put([]byte("b"), make([]byte, 100)))
+		assert.Zero(t, bc.unsynced)
+	})
+
+	t.Run("interval", func(t *testing.T) {
+		bc := openTestBitcask(t, t.TempDir(), WithSyncInterval(10*time.Millisecond))
+		require.NoError(t, bc.Put([]byte("a"), []byte("1")))
+		assert.Eventually(t, func() bool {
+			bc.writeMu.Lock()
+			defer bc.writeMu.Unlock()
+			return bc.unsynced == 0
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("never", func(t *testing.T) {
+		bc := openTestBitcask(t, t.TempDir(), WithSyncNever())
+		require.NoError(t, bc.Put([]byte("a"), []byte("1")))
+		assert.NotZero(t, bc.unsynced)
+		require.NoError(t, bc.Sync())
+		assert.Zero(t, bc.unsynced)
+	})
+}
+
+func TestClose(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := NewBitcask(dir, WithSyncInterval(time.Millisecond))
+	require.NoError(t, err)
+	require.NoError(t, bc.Put([]byte("a"), []byte("1")))
+	require.NoError(t, bc.Close())
+	require.NoError(t, bc.Close())
+
+	assert.ErrorIs(t, bc.Put([]byte("a"), []byte("2")), ErrClosed)
+	_, err = bc.Get([]byte("a"))
+	assert.ErrorIs(t, err, ErrClosed)
+	assert.ErrorIs(t, bc.Delete([]byte("a")), ErrClosed)
+	assert.ErrorIs(t, bc.Sync(), ErrClosed)
+	assert.ErrorIs(t, bc.Merge(), ErrClosed)
+
+	bc = openTestBitcask(t, dir)
+	value, err := bc.Get([]byte("a"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+}
+
+func TestConcurrentReadsAndWrites(t *testing.T) {
+	bc := openTestBitcask(t, t.TempDir(), WithMaxFileSize(1024))
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, bc.Put([]byte(fmt.Sprintf("key-%03d", i)), []byte(fmt.Sprintf("value-%03d", i))))
+	}
+
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 500; n++ {
+				i := n % 100
+				value, err := bc.Get([]byte(fmt.Sprintf("key-%03d", i)))
+				if assert.NoError(t, err) {
+					assert.Equal(t, []byte(fmt.Sprintf("value-%03d", i)), value)
+				}
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			assert.NoError(t, bc.Put([]byte(fmt.Sprintf("other-%03d", i)), []byte("x")))
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, bc.Merge())
+	}()
+
+	wg.Wait()
+}
+
+func TestGetReadsValueFromKeyDirPosition(t *testing.T) {
+	dir := t.TempDir()
+	bc := openTestBitcask(t, dir)
+	require.NoError(t, bc.Put([]byte("key"), []byte("value")))
+
+	pos, ok := bc.keyDir.Get("key")
+	require.True(t, ok)
+	assert.Equal(t, uint32(len("value")), pos.ValueSize)
+	assert.Equal(t, int64(segmentHeaderSize+entryHeaderSize+len("key")), pos.ValuePos)
+	assert.NotZero(t, pos.Timestamp)
+
+	// 破壞 value 後，一般的 Get 不校驗 CRC，GetVerified 則會發現錯誤
+	require.NoError(t, bc.Sync())
+	file, err := os.OpenFile(segmentPath(dir, 0), os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteAt([]byte("V"), pos.ValuePos)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	value, err := bc.Get([]byte("key"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("Value"), value)
+
+	_, err = bc.GetVerified([]byte("key"))
+	assert.Error(t, err)
+
+	verifying := openTestBitcask(t, t.TempDir(), WithVerifyChecksum(true))
+	require.NoError(t, verifying.Put([]byte("key"), []byte("value")))
+	value, err = verifying.Get([]byte("key"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value"), value)
+}
+
+func TestScanRangeAndIterator(t *testing.T) {
+	bc := openTestBitcask(t, t.TempDir())
+
+	keys := []string{"user:1:name", "user:1:profile", "user:2:name", "user:10:name", "order:1", "zeta"}
+	for _, key := range keys {
+		require.NoError(t, bc.Put([]byte(key), []byte("v:"+key)))
+	}
+	require.NoError(t, bc.PutWithTTL([]byte("user:3:name"), []byte("gone"), time.Nanosecond))
+	time.Sleep(time.Millisecond)
+
+	assert.Equal(t, []string{"user:1:name", "user:1:profile"}, bc.Scan([]byte("user:1:")))
+	// 依位元組字典序，"user:10" 排在 "user:1:" 之前
+	assert.Equal(t, []string{"user:10:name", "user:1:name", "user:1:profile", "user:2:name"}, bc.Scan([]byte("user:")))
+	assert.Equal(t, []string{"order:1", "user:10:name", "user:1:name", "user:1:profile", "user:2:name", "zeta"}, bc.ListKeys())
+	assert.Equal(t, []string{"user:10:name", "user:1:name", "user:1:profile"}, bc.Range([]byte("user:1"), []byte("user:2")))
+	assert.Equal(t, []string{"user:2:name", "zeta"}, bc.Range([]byte("user:2"), nil))
+
+	collect := func(it *Iterator) []string {
+		var got []string
+		for ; it.Valid(); it.Next() {
+			value, err := it.Value()
+			require.NoError(t, err)
+			assert.Equal(t, "v:"+string(it.Key()), string(value))
+			got = append(got, string(it.Key()))
+		}
+		return got
+	}
+
+	assert.Equal(t, bc.ListKeys(), collect(bc.NewIterator(IteratorOptions{})))
+	assert.Equal(t,
+		[]string{"user:2:name", "user:1:profile", "user:1:name", "user:10:name"},
+		collect(bc.NewIterator(IteratorOptions{Prefix: []byte("user:"), Reverse: true})))
+
+	it := bc.NewIterator(IteratorOptions{Prefix: []byte("user:")})
+	it.Seek([]byte("user:1:o"))
+	assert.Equal(t, []string{"user:1:profile", "user:2:name"}, collect(it))
+
+	it = bc.NewIterator(IteratorOptions{Reverse: true})
+	it.Seek([]byte("user:1:z"))
+	assert.Equal(t, []string{"user:1:profile", "user:1:name", "user:10:name", "order:1"}, collect(it))
+}
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	bc := openTestBitcask(t, dir, WithMaxFileSize(256))
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, bc.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte(fmt.Sprintf("old-%02d", i))))
+	}
+
+	snap, err := bc.Snapshot()
+	require.NoError(t, err)
+
+	// 快照之後的覆寫、刪除、新增與合併都不應影響快照
+	for i := 0; i < 20; i++ {
+		key := []byte(fmt.Sprintf("key-%02d", i))
+		if i%2 == 0 {
+			require.NoError(t, bc.Delete(key))
+		} else {
+			require.NoError(t, bc.Put(key, []byte(fmt.Sprintf("new-%02d", i))))
+		}
+	}
+	require.NoError(t, bc.Put([]byte("extra"), []byte("value")))
+	require.NoError(t, bc.Merge())
+
+	for i := 0; i < 20; i++ {
+		value, err := snap.Get([]byte(fmt.Sprintf("key-%02d", i)))
+		require.NoError(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("old-%02d", i)), value)
+	}
+	_, err = snap.Get([]byte("extra"))
+	assert.Error(t, err)
+	assert.Equal(t, 20, snap.Len())
+	assert.Equal(t, []string{"key-10", "key-11"}, snap.Range([]byte("key-10"), []byte("key-12")))
+	assert.Len(t, snap.Scan([]byte("key-")), 20)
+
+	it := snap.NewIterator(IteratorOptions{Prefix: []byte("key-1"), Reverse: true})
+	require.True(t, it.Valid())
+	assert.Equal(t, []byte("key-19"), it.Key())
+	value, err := it.Value()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("old-19"), value)
+
+	// 資料庫本身看到的是最新狀態
+	value, err = bc.Get([]byte("key-19"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("new-19"), value)
+	assert.Len(t, bc.ListKeys(), 11)
+
+	// 資料庫關閉後快照仍可讀取，直到被釋放
+	require.NoError(t, bc.Close())
+	value, err = snap.Get([]byte("key-00"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("old-00"), value)
+
+	require.NoError(t, snap.Release())
+	require.NoError(t, snap.Release())
+	_, err = snap.Get([]byte("key-00"))
+	assert.ErrorIs(t, err, ErrSnapshotReleased)
+}
+
+func TestSnapshotWithConcurrentWrites(t *testing.T) {
+	bc := openTestBitcask(t, t.TempDir(), WithMaxFileSize(512))
+
+	for i := 0; i < 50; i++ {
+		require.NoError(t, bc.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte("v0")))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for round := 1; round <= 20; round++ {
+			wb := bc.NewWriteBatch()
+			for i := 0; i < 50; i++ {
+				wb.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte(fmt.Sprintf("v%d", round)))
+			}
+			assert.NoError(t, wb.Commit())
+			if round%5 == 0 {
+				assert.NoError(t, bc.Merge())
+			}
+		}
+	}()
+
+	// 每個快照中所有 key 都應屬於同一個批次
+	for n := 0; n < 20; n++ {
+		snap, err := bc.Snapshot()
+		require.NoError(t, err)
+		first, err := snap.Get([]byte("key-00"))
+		require.NoError(t, err)
+		for _, key := range snap.ListKeys() {
+			value, err := snap.Get([]byte(key))
+			require.NoError(t, err)
+			assert.Equal(t, first, value, key)
+		}
+		require.NoError(t, snap.Release())
+	}
+	wg.Wait()
+}
+
+func TestDirectoryLock(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := NewBitcask(dir)
+	require.NoError(t, err)
+	require.NoError(t, bc.Put([]byte("a"), []byte("1")))
+
+	// 寫入中的目錄不能再以任何模式開啟
+	_, err = NewBitcask(dir)
+	assert.ErrorIs(t, err, ErrLocked)
+	var lockErr *LockError
+	require.ErrorAs(t, err, &lockErr)
+	assert.False(t, lockErr.Shared)
+
+	_, err = NewBitcask(dir, WithReadOnly())
+	assert.ErrorIs(t, err, ErrLocked)
+
+	require.NoError(t, bc.Close())
+
+	// 關閉後可以重新開啟
+	bc, err = NewBitcask(dir)
+	require.NoError(t, err)
+	require.NoError(t, bc.Close())
+}
+
+func TestReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := NewBitcask(dir)
+	require.NoError(t, err)
+	require.NoError(t, bc.Put([]byte("a"), []byte("1")))
+	validSize := bc.active.size
+	require.NoError(t, bc.Close())
+
+	// 模擬寫到一半的尾端，唯讀開啟時不應截斷檔案
+	file, err := os.OpenFile(segmentPath(dir, 0), os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = file.Write([]byte{0, 0, 0})
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	r1 := openTestBitcask(t, dir, WithReadOnly())
+	r2 := openTestBitcask(t, dir, WithReadOnly())
+
+	for _, r := range []*Bitcask{r1, r2} {
+		value, err := r.Get([]byte("a"))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("1"), value)
+	}
+
+	assert.ErrorIs(t, r1.Put([]byte("b"), []byte("2")), ErrReadOnly)
+	assert.ErrorIs(t, r1.Delete([]byte("a")), ErrReadOnly)
+	wb := r1.NewWriteBatch()
+	wb.Put([]byte("b"), []byte("2"))
+	assert.ErrorIs(t, wb.Commit(), ErrReadOnly)
+	assert.ErrorIs(t, r1.Merge(), ErrReadOnly)
+	assert.NoError(t, r1.Sync())
+
+	info, err := os.Stat(segmentPath(dir, 0))
+	require.NoError(t, err)
+	assert.Equal(t, validSize+3, info.Size())
+
+	// 有唯讀程序開啟時不能以寫入模式開啟
+	_, err = NewBitcask(dir)
+	assert.ErrorIs(t, err, ErrLocked)
+
+	require.NoError(t, r1.Close())
+	require.NoError(t, r2.Close())
+	bc = openTestBitcask(t, dir)
+	assert.Equal(t, validSize, bc.active.size)
+
+	// 不存在或沒有資料的目錄不能以唯讀模式開啟
+	_, err = NewBitcask(filepath.Join(dir, "missing"), WithReadOnly())
+	assert.Error(t, err)
+	_, err = NewBitcask(t.TempDir(), WithReadOnly())
+	assert.Error(t, err)
+}
+
+func TestCompression(t *testing.T) {
+	dir := t.TempDir()
+	value := []byte(strings.Repeat(`{"name":"bitcask","tags":["a","b","c"]},`, 100))
+
+	bc := openTestBitcask(t, dir, WithCompression(FlateCompression))
+	require.NoError(t, bc.Put([]byte("json"), value))
+	require.NoError(t, bc.Put([]byte("small"), []byte("x")))
+	assert.Less(t, bc.active.size, int64(len(value)))
+
+	pos, ok := bc.keyDir.Get("json")
+	require.True(t, ok)
+	assert.Equal(t, FlagCompressed, pos.Flags)
+	pos, ok = bc.keyDir.Get("small")
+	require.True(t, ok)
+	assert.Zero(t, pos.Flags, "壓縮後沒有變小的 value 應保存原始資料")
+
+	got, err := bc.Get([]byte("json"))
+	require.NoError(t, err)
+	assert.Equal(t, value, got)
+	got, err = bc.GetVerified([]byte("json"))
+	require.NoError(t, err)
+	assert.Equal(t, value, got)
+	require.NoError(t, bc.Close())
+
+	// 不啟用壓縮重新開啟，新舊兩種 Entry 混合時都能正確讀取
+	bc = openTestBitcask(t, dir)
+	require.NoError(t, bc.Put([]byte("raw"), value))
+	for _, key := range []string{"json", "raw"} {
+		got, err := bc.Get([]byte(key))
+		require.NoError(t, err)
+		assert.Equal(t, value, got, key)
+	}
+	require.NoError(t, bc.Close())
+
+	// 以壓縮設定合併後，舊的未壓縮資料也被壓縮，並在提示檔中保留旗標
+	bc = openTestBitcask(t, dir, WithCompression(FlateCompression))
+	require.NoError(t, bc.Merge())
+	require.NoError(t, bc.Close())
+
+	bc = openTestBitcask(t, dir)
+	for _, key := range []string{"json", "raw"} {
+		pos, ok := bc.keyDir.Get(key)
+		require.True(t, ok)
+		assert.Equal(t, FlagCompressed, pos.Flags, key)
+		got, err := bc.Get([]byte(key))
+		require.NoError(t, err)
+		assert.Equal(t, value, got, key)
+	}
+
+	// 不壓縮的設定下合併會把資料還原為原始格式
+	require.NoError(t, bc.Merge())
+	pos, ok = bc.keyDir.Get("json")
+	require.True(t, ok)
+	assert.Zero(t, pos.Flags)
+	got, err = bc.Get([]byte("json"))
+	require.NoError(t, err)
+	assert.Equal(t, value, got)
+}
+
+func TestEncryption(t *testing.T) {
+	dir := t.TempDir()
+	key1 := bytes.Repeat([]byte{1}, 32)
+	key2 := bytes.Repeat([]byte{2}, 32)
+	secret := []byte(strings.Repeat("customer-pii;", 20))
+
+	bc := openTestBitcask(t, dir, WithEncryption(key1, 1), WithCompression(FlateCompression))
+	require.NoError(t, bc.Put([]byte("user:1"), secret))
+	got, err := bc.GetVerified([]byte("user:1"))
+	require.NoError(t, err)
+	assert.Equal(t, secret, got)
+	require.NoError(t, bc.Close())
+
+	// key 與 value 都不會以明文寫入日誌
+	data, err := os.ReadFile(segmentPath(dir, 0))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "customer-pii")
+	assert.NotContains(t, string(data), "user:1")
+
+	// 缺少金鑰或金鑰錯誤時無法解密 key 建立索引，返回驗證錯誤而不是 CRC 錯誤
+	_, err = NewBitcask(dir)
+	assert.ErrorIs(t, err, ErrAuthentication)
+	_, err = NewBitcask(dir, WithEncryption(key2, 1))
+	assert.ErrorIs(t, err, ErrAuthentication)
+
+	// 輪替金鑰：以新金鑰寫入，舊金鑰只用來解密，合併後資料改用新金鑰加密
+	bc = openTestBitcask(t, dir, WithEncryption(key2, 2), WithDecryptionKey(key1, 1))
+	require.NoError(t, bc.Put([]byte("user:2"), []byte("new")))
+	got, err = bc.Get([]byte("user:1"))
+	require.NoError(t, err)
+	assert.Equal(t, secret, got)
+	require.NoError(t, bc.Merge())
+	require.NoError(t, bc.Close())
+
+	// 合併後的提示檔同樣不含明文的 key
+	hint, err := os.ReadFile(hintPath(dir, 0))
+	require.NoError(t, err)
+	assert.NotContains(t, string(hint), "user:")
+
+	bc = openTestBitcask(t, dir, WithEncryption(key2, 2))
+	for key, want := range map[string][]byte{"user:1": secret, "user:2": []byte("new")} {
+		pos, ok := bc.keyDir.Get(key)
+		require.True(t, ok)
+		assert.Equal(t, uint32(2), pos.KeyID, key)
+		got, err := bc.Get([]byte(key))
+		require.NoError(t, err)
+		assert.Equal(t, want, got, key)
+	}
+	events, err := bc.WatchFrom([]byte("user:"), Position{})
+	require.NoError(t, err)
+	assert.Len(t, collectEvents(t, events, 2), 2)
+	events.Close()
+	require.NoError(t, bc.Delete([]byte("user:2")))
+	require.NoError(t, bc.Close())
+
+	bc = openTestBitcask(t, dir, WithEncryption(key2, 2))
+	assert.Equal(t, []string{"user:1"}, bc.ListKeys())
+
+	_, err = NewBitcask(t.TempDir(), WithEncryption([]byte("short"), 1))
+	assert.Error(t, err)
+}
+
+func TestEncryptionSealsOldPlaintextKeysOnMerge(t *testing.T) {
+	dir := t.TempDir()
+	key := bytes.Repeat([]byte{1}, 32)
+	aead, err := newAEAD(key)
+	require.NoError(t, err)
+
+	// 只加密 value、key 仍是明文的舊 Entry
+	value, err := sealValue(aead, []byte("user:1"), []byte("secret"))
+	require.NoError(t, err)
+	entry := NewEntry([]byte("user:1"), value, PUT)
+	entry.Flags = FlagEncrypted
+	entry.KeyID = 1
+	data, err := entry.Encode()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(segmentPath(dir, 0), append(encodeFileHeader(segmentMagic), data...), 0644))
+
+	bc := openTestBitcask(t, dir, WithEncryption(key, 1))
+	got, err := bc.GetVerified([]byte("user:1"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("secret"), got)
+
+	require.NoError(t, bc.Merge())
+	raw, err := os.ReadFile(segmentPath(dir, 0))
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "user:1")
+	got, err = bc.Get([]byte("user:1"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("secret"), got)
+}
+
+func TestErrors(t *testing.T) {
+	dir := t.TempDir()
+	bc := openTestBitcask(t, dir, WithSweepInterval(0))
+
+	_, err := bc.Get([]byte("missing"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	assert.ErrorIs(t, bc.Delete([]byte("missing")), ErrKeyNotFound)
+	assert.ErrorIs(t, bc.PutWithTTL([]byte("k"), []byte("v"), 0), ErrInvalidTTL)
+
+	require.NoError(t, bc.Put([]byte("deleted"), []byte("v")))
+	require.NoError(t, bc.Delete([]byte("deleted")))
+	_, err = bc.Get([]byte("deleted"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	// 破壞 value 的一個位元組，校驗時返回帶有位置資訊的 ErrCorrupt
+	require.NoError(t, bc.Put([]byte("key"), []byte("value")))
+	pos, ok := bc.keyDir.Get("key")
+	require.True(t, ok)
+	file, err := os.OpenFile(segmentPath(dir, pos.FileID), os.O_RDWR, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteAt([]byte("V"), pos.ValuePos)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	_, err = bc.GetVerified([]byte("key"))
+	assert.ErrorIs(t, err, ErrChecksum)
+	var corrupt *ErrCorrupt
+	require.ErrorAs(t, err, &corrupt)
+	assert.Equal(t, pos.FileID, corrupt.Segment)
+	assert.Equal(t, pos.entryOffset(len("key")), corrupt.Offset)
+
+	_, err = Decode(make([]byte, 3))
+	assert.ErrorIs(t, err, ErrTruncated)
+}
+
+func TestStats(t *testing.T) {
+	bc := openTestBitcask(t, t.TempDir(), WithMaxFileSize(256))
+
+	for round := 0; round < 4; round++ {
+		for i := 0; i < 10; i++ {
+			require.NoError(t, bc.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte(fmt.Sprintf("value-%d", round))))
+		}
+	}
+	require.NoError(t, bc.Delete([]byte("key-00")))
+
+	stats, err := bc.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, 9, stats.LiveKeys)
+	assert.Greater(t, len(stats.Segments), 1)
+	assert.True(t, stats.Segments[len(stats.Segments)-1].Active)
+	assert.True(t, stats.LastMerge.IsZero())
+
+	var total, live int64
+	for _, s := range stats.Segments {
+		assert.Equal(t, s.TotalBytes, segmentHeaderSize+s.LiveBytes+s.DeadBytes)
+		total += s.TotalBytes
+		live += s.LiveBytes
+	}
+	assert.Equal(t, total, stats.TotalBytes)
+	assert.Equal(t, live, stats.LiveBytes)
+	entrySize := int64(entryHeaderSize + len("key-01") + len("value-3"))
+	assert.Equal(t, 9*entrySize, stats.LiveBytes)
+	assert.Greater(t, stats.Fragmentation, 0.5)
+
+	require.NoError(t, bc.Merge())
+	stats, err = bc.Stats()
+	require.NoError(t, err)
+	assert.Zero(t, stats.DeadBytes)
+	assert.Zero(t, stats.Fragmentation)
+	assert.Equal(t, 9, stats.LiveKeys)
+	assert.False(t, stats.LastMerge.IsZero())
+}
+
+func TestStatsDuringPutStream(t *testing.T) {
+	bc := openTestBitcask(t, t.TempDir())
+	require.NoError(t, bc.Put([]byte("key"), []byte("value")))
+	before, err := bc.Stats()
+	require.NoError(t, err)
+
+	// 串流寫入進行中時 Stats 不必等待，也不計入寫到一半的 Entry
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- bc.PutStream([]byte("stream"), pr, 1000) }()
+	_, err = pw.Write(bytes.Repeat([]byte("x"), 500))
+	require.NoError(t, err)
+
+	statsDone := make(chan Stats, 1)
+	go func() {
+		stats, err := bc.Stats()
+		assert.NoError(t, err)
+		statsDone <- stats
+	}()
+	select {
+	case stats := <-statsDone:
+		assert.Equal(t, before.TotalBytes, stats.TotalBytes)
+		assert.Equal(t, before.LiveKeys, stats.LiveKeys)
+		assert.Zero(t, stats.DeadBytes)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stats blocked by PutStream")
+	}
+
+	_, err = pw.Write(bytes.Repeat([]byte("x"), 500))
+	require.NoError(t, err)
+	require.NoError(t, <-done)
+	stats, err := bc.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.LiveKeys)
+	assert.Zero(t, stats.DeadBytes)
+}
+
+func TestAutoMerge(t *testing.T) {
+	policy := MergePolicy{
+		Interval:     10 * time.Millisecond,
+		MinDeadRatio: 0.5,
+	}
+	bc := openTestBitcask(t, t.TempDir(), WithMaxFileSize(256), WithAutoMerge(policy))
+
+	require.NoError(t, bc.Put([]byte("key"), []byte("value")))
+	stats, err := bc.Stats()
+	require.NoError(t, err)
+	assert.False(t, policy.shouldMerge(stats), "沒有無效資料時不應合併")
+	assert.False(t, bc.autoMergeTick(policy, time.Now()))
+	stats, err = bc.Stats()
+	require.NoError(t, err)
+	assert.True(t, stats.LastMerge.IsZero())
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, bc.Put([]byte("key"), []byte(fmt.Sprintf("value-%d", i))))
+	}
+	assert.Eventually(t, func() bool {
+		stats, err := bc.Stats()
+		return err == nil && !stats.LastMerge.IsZero() && stats.Fragmentation < 0.5
+	}, 2*time.Second, 10*time.Millisecond)
+
+	value, err := bc.Get([]byte("key"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value-19"), value)
+}
+
+func TestMergePolicy(t *testing.T) {
+	policy := MergePolicy{MinDeadBytes: 100}
+	assert.False(t, policy.shouldMerge(Stats{DeadBytes: 99, TotalBytes: 100, Fragmentation: 0.99}))
+	assert.True(t, policy.shouldMerge(Stats{DeadBytes: 100, TotalBytes: 1000, Fragmentation: 0.1}))
+
+	at := func(hour int) time.Time { return time.Date(2024, 1, 1, hour, 30, 0, 0, time.Local) }
+
+	night := MergePolicy{WindowStart: 22 * time.Hour, WindowEnd: 4 * time.Hour}
+	assert.True(t, night.inWindow(at(23)))
+	assert.True(t, night.inWindow(at(2)))
+	assert.False(t, night.inWindow(at(12)))
+
+	day := MergePolicy{WindowStart: 9 * time.Hour, WindowEnd: 17 * time.Hour}
+	assert.True(t, day.inWindow(at(12)))
+	assert.False(t, day.inWindow(at(20)))
+
+	assert.True(t, MergePolicy{}.inWindow(at(12)))
+}
+
+func TestBackup(t *testing.T) {
+	bc := openTestBitcask(t, t.TempDir(), WithMaxFileSize(512))
+
+	for i := 0; i < 50; i++ {
+		require.NoError(t, bc.Put([]byte(fmt.Sprintf("key-%02d", i)), []byte(fmt.Sprintf("value-%02d", i))))
+	}
+
+	// 備份期間持續寫入與合併
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for n := 0; ; n++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			assert.NoError(t, bc.Put([]byte(fmt.Sprintf("new-%04d", n)), []byte("v")))
+			if n%100 == 0 {
+				bc.Merge()
+			}
+		}
+	}()
+
+	dst := filepath.Join(t.TempDir(), "backup")
+	require.NoError(t, bc.Backup(dst))
+	close(stop)
+	wg.Wait()
+
+	backup := openTestBitcask(t, dst)
+	for i := 0; i < 50; i++ {
+		value, err := backup.Get([]byte(fmt.Sprintf("key-%02d", i)))
+		require.NoError(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("value-%02d", i)), value)
+	}
+	for _, key := range backup.Scan([]byte("new-")) {
+		value, err := backup.Get([]byte(key))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("v"), value)
+	}
+
+	// 目標目錄不是空目錄時拒絕覆寫
+	assert.Error(t, bc.Backup(dst))
+
+	// 合併產生的提示檔與對應的資料段一起備份
+	require.NoError(t, bc.Merge())
+	hints, err := filepath.Glob(filepath.Join(bc.dir, "*"+hintFileExt))
+	require.NoError(t, err)
+	require.NotEmpty(t, hints)
+
+	dst = filepath.Join(t.TempDir(), "backup")
+	require.NoError(t, bc.Backup(dst))
+	for _, hint := range hints {
+		want, err := os.ReadFile(hint)
+		require.NoError(t, err)
+		got, err := os.ReadFile(filepath.Join(dst, filepath.Base(hint)))
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	backup = openTestBitcask(t, dst)
+	for i := 0; i < 50; i++ {
+		value, err := backup.Get([]byte(fmt.Sprintf("key-%02d", i)))
+		require.NoError(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("value-%02d", i)), value)
+	}
+}
+
+func TestVerifyAndRepair(t *testing.T) {
+	dir := t.TempDir()
+	bc := openTestBitcask(t, dir)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, bc.Put([]byte(key), []byte("value-"+key)))
+	}
+	batch := bc.NewWriteBatch()
+	batch.Put([]byte("x"), []byte("batched"))
+	batch.Put([]byte("y"), []byte("batched"))
+	require.NoError(t, batch.Commit())
+	require.NoError(t, bc.Put([]byte("e"), []byte("value-e")))
+	require.NoError(t, bc.Close())
+
+	offsets := make(map[string]int64)
+	var commit int64
+	require.NoError(t, WalkEntries(dir, func(_ uint32, offset int64, e *Entry) error {
+		if e.Mark == BATCH_COMMIT {
+			commit = offset
+		}
+		offsets[string(e.Key)] = offset
+		return nil
+	}))
+
+	report, err := Verify(dir)
+	require.NoError(t, err)
+	assert.True(t, report.OK())
+	assert.Equal(t, 9, report.Entries)
+
+	// 破壞 c 的 value 與批次的 COMMIT 標記
+	path := segmentPath(dir, 0)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[offsets["c"]+entryHeaderSize+1] ^= 0xff
+	data[commit+entryHeaderSize] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	report, err = Verify(dir)
+	require.NoError(t, err)
+	require.Len(t, report.Corrupt, 2)
+	assert.Equal(t, offsets["c"], report.Corrupt[0].Offset)
+	assert.Equal(t, offsets["d"]-offsets["c"], report.Corrupt[0].Length)
+	assert.ErrorIs(t, report.Corrupt[0].Err, ErrChecksum)
+	assert.Equal(t, commit, report.Corrupt[1].Offset)
+	assert.Equal(t, offsets["e"]-commit, report.Corrupt[1].Length)
+	assert.Equal(t, 7, report.Entries)
+
+	dst := filepath.Join(t.TempDir(), "repaired")
+	_, err = Repair(dir, dst)
+	require.NoError(t, err)
+
+	repaired := openTestBitcask(t, dst)
+	for _, key := range []string{"a", "b", "d", "e"} {
+		value, err := repaired.Get([]byte(key))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("value-"+key), value)
+	}
+	// 損壞的 Entry 與 COMMIT 標記損壞的批次都不會被救回
+	for _, key := range []string{"c", "x", "y"} {
+		_, err := repaired.Get([]byte(key))
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+	}
+
+	report, err = Verify(dst)
+	require.NoError(t, err)
+	assert.True(t, report.OK())
+
+	// 目標目錄不是空目錄時拒絕覆寫
+	_, err = Repair(dir, dst)
+	assert.Error(t, err)
+}
+
+func TestGetWithCRC(t *testing.T) {
+	bc := openTestBitcask(t, t.TempDir())
+	require.NoError(t, bc.Put([]byte("key"), []byte("v1")))
+
+	value, crc1, err := bc.GetWithCRC([]byte("key"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v1"), value)
+
+	require.NoError(t, bc.Put([]byte("key"), []byte("v2")))
+	_, crc2, err := bc.GetWithCRC([]byte("key"))
+	require.NoError(t, err)
+	assert.NotEqual(t, crc1, crc2)
+
+	// CRC 涵蓋標頭中的時間與序號，重新寫入相同的值也會得到不同的 CRC
+	require.NoError(t, bc.Put([]byte("key"), []byte("v1")))
+	_, crc3, err := bc.GetWithCRC([]byte("key"))
+	require.NoError(t, err)
+	assert.NotEqual(t, crc1, crc3)
+
+	_, _, err = bc.GetWithCRC([]byte("missing"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestVerifyAndRepairEmptyKey(t *testing.T) {
+	dir := t.TempDir()
+	bc := openTestBitcask(t, dir)
+	require.NoError(t, bc.Put([]byte(""), []byte("v")))
+	require.NoError(t, bc.Put([]byte("k"), []byte("v")))
+	require.NoError(t, bc.Delete([]byte("k")))
+	require.NoError(t, bc.Close())
+
+	report, err := Verify(dir)
+	require.NoError(t, err)
+	assert.True(t, report.OK(), "%v", report.Corrupt)
+	assert.Equal(t, 3, report.Entries)
+
+	dst := filepath.Join(t.TempDir(), "repaired")
+	report, err = Repair(dir, dst)
+	require.NoError(t, err)
+	assert.Empty(t, report.Corrupt)
+
+	repaired := openTestBitcask(t, dst)
+	value, err := repaired.Get([]byte(""))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v"), value)
+	_, err = repaired.Get([]byte("k"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestPutIfCRC(t *testing.T) {
+	bc := openTestBitcask(t, t.TempDir())
+	absent := func(_ uint32, exists bool) bool { return !exists }
+	matches := func(want uint32) CRCCondition {
+		return func(crc uint32, exists bool) bool { return exists && crc == want }
+	}
+
+	require.NoError(t, bc.PutIfCRC([]byte("key"), []byte("v1"), 0, absent))
+	assert.ErrorIs(t, bc.PutIfCRC([]byte("key"), []byte("v2"), 0, absent), ErrConditionFailed)
+
+	_, crc, err := bc.GetWithCRC([]byte("key"))
+	require.NoError(t, err)
+	require.NoError(t, bc.PutIfCRC([]byte("key"), []byte("v2"), time.Hour, matches(crc)))
+	// 舊的 CRC 已經失效
+	assert.ErrorIs(t, bc.PutIfCRC([]byte("key"), []byte("v3"), 0, matches(crc)), ErrConditionFailed)
+	assert.ErrorIs(t, bc.DeleteIfCRC([]byte("key"), matches(crc)), ErrConditionFailed)
+
+	value, crc, err := bc.GetWithCRC([]byte("key"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v2"), value)
+	require.NoError(t, bc.DeleteIfCRC([]byte("key"), matches(crc)))
+	assert.ErrorIs(t, bc.DeleteIfCRC([]byte("key"), absent), ErrKeyNotFound)
+	assert.ErrorIs(t, bc.PutIfCRC([]byte("key"), nil, -time.Second, absent), ErrInvalidTTL)
+}
+
+// collectEvents 從 Watcher 讀出 n 個事件，逾時則測試失敗
+func collectEvents(t *testing.T, w *Watcher, n int) []Event {
+	t.Helper()
+	var events []Event
+	for len(events) < n {
+		select {
+		case ev, ok := <-w.Events():
+			require.True(t, ok, "watcher stopped: %v", w.Err())
+			events = append(events, ev)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out after %d events", len(events))
+		}
+	}
+	return events
+}
+
+func TestWatch(t *testing.T) {
+	bc := openTestBitcask(t, t.TempDir(), WithMaxFileSize(256), WithCompression(FlateCompression))
+	require.NoError(t, bc.Put([]byte("user:0"), []byte("before watch")))
+
+	w, err := bc.Watch([]byte("user:"))
+	require.NoError(t, err)
+	defer w.Close()
+
+	require.NoError(t, bc.Put([]byte("user:1"), bytes.Repeat([]byte("a"), 100)))
+	require.NoError(t, bc.Put([]byte("order:1"), []byte("ignored")))
+	require.NoError(t, bc.Delete([]byte("user:0")))
+	batch := bc.NewWriteBatch()
+	batch.Put([]byte("user:2"), []byte("batched"))
+	batch.Put([]byte("order:2"), []byte("ignored"))
+	require.NoError(t, batch.PutWithTTL([]byte("user:3"), []byte("ttl"), time.Hour))
+	require.NoError(t, batch.Commit())
+
+	events := collectEvents(t, w, 4)
+	assert.Equal(t, EventPut, events[0].Type)
+	assert.Equal(t, []byte("user:1"), events[0].Key)
+	assert.Equal(t, bytes.Repeat([]byte("a"), 100), events[0].Value)
+	assert.Equal(t, EventDelete, events[1].Type)
+	assert.Equal(t, []byte("user:0"), events[1].Key)
+	assert.Nil(t, events[1].Value)
+	assert.Equal(t, []byte("user:2"), events[2].Key)
+	assert.Equal(t, []byte("user:3"), events[3].Key)
+	assert.NotZero(t, events[3].ExpiresAt)
+
+	// 從第二個事件之後接續，包含接續前尚未看過的寫入
+	require.NoError(t, w.Close())
+	_, ok := <-w.Events()
+	assert.False(t, ok)
+	assert.NoError(t, w.Err())
+
+	require.NoError(t, bc.Put([]byte("user:4"), []byte("after close")))
+	resumed, err := bc.WatchFrom([]byte("user:"), events[1].Position)
+	require.NoError(t, err)
+	defer resumed.Close()
+	require.NoError(t, bc.Put([]byte("user:5"), []byte("after resume")))
+
+	var keys []string
+	for _, ev := range collectEvents(t, resumed, 4) {
+		keys = append(keys, string(ev.Key))
+	}
+	assert.Equal(t, []string{"user:2", "user:3", "user:4", "user:5"}, keys)
+
+	// 零值位置從最舊的資料段開始重播
+	all, err := bc.WatchFrom(nil, Position{})
+	require.NoError(t, err)
+	defer all.Close()
+	assert.Equal(t, []byte("user:0"), collectEvents(t, all, 1)[0].Key)
+}
+
+func TestWatchCompacted(t *testing.T) {
+	dir := t.TempDir()
+	bc := openTestBitcask(t, dir, WithMaxFileSize(512))
+
+	require.NoError(t, bc.Put([]byte("key-000"), []byte("v")))
+	w, err := bc.WatchFrom(nil, Position{})
+	require.NoError(t, err)
+	defer w.Close()
+	first := collectEvents(t, w, 1)[0]
+
+	// 不消費事件讓 Watcher 落後，之後的資料段被合併改寫
+	for i := 1; i < 200; i++ {
+		require.NoError(t, bc.Put([]byte(fmt.Sprintf("key-%03d", i)), []byte("v")))
+	}
+	require.NoError(t, bc.Merge())
+
+	received := 1
+	for range w.Events() {
+		received++
+	}
+	assert.ErrorIs(t, w.Err(), ErrCompacted)
+	assert.Less(t, received, 200)
+
+	_, err = bc.WatchFrom(nil, first.Position)
+	assert.ErrorIs(t, err, ErrCompacted)
+
+	// 合併之後的位置仍可接續
+	w2, err := bc.Watch(nil)
+	require.NoError(t, err)
+	defer w2.Close()
+	require.NoError(t, bc.Put([]byte("after-merge"), []byte("v")))
+	ev := collectEvents(t, w2, 1)[0]
+	require.NoError(t, w2.Close())
+
+	require.NoError(t, bc.Put([]byte("later"), []byte("v")))
+	w3, err := bc.WatchFrom(nil, ev.Position)
+	require.NoError(t, err)
+	defer w3.Close()
+	assert.Equal(t, []byte("later"), collectEvents(t, w3, 1)[0].Key)
+
+	// 資料庫關閉時 Watcher 以 ErrClosed 結束
+	require.NoError(t, bc.Close())
+	for range w3.Events() {
+	}
+	assert.ErrorIs(t, w3.Err(), ErrClosed)
+
+	// 重新開啟後由提示檔得知哪些資料段已被合併
+	bc = openTestBitcask(t, dir, WithMaxFileSize(512))
+	_, err = bc.WatchFrom(nil, first.Position)
+	assert.ErrorIs(t, err, ErrCompacted)
+	w4, err := bc.WatchFrom(nil, ev.Position)
+	require.NoError(t, err)
+	defer w4.Close()
+	assert.Equal(t, []byte("later"), collectEvents(t, w4, 1)[0].Key)
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	dir := t.TempDir()
+	clock := newFakeClock()
+	bc := openTestBitcask(t, dir, withClock(clock.Now))
+
+	v1, err := bc.PutIfAbsent([]byte("lock"), []byte("owner-a"))
+	require.NoError(t, err)
+	_, err = bc.PutIfAbsent([]byte("lock"), []byte("owner-b"))
+	assert.ErrorIs(t, err, ErrKeyExists)
+
+	value, version, err := bc.GetWithVersion([]byte("lock"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("owner-a"), value)
+	assert.Equal(t, v1, version)
+
+	_, err = bc.CompareAndSwap([]byte("lock"), v1+1, []byte("owner-b"))
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+	v2, err := bc.CompareAndSwap([]byte("lock"), v1, []byte("owner-b"))
+	require.NoError(t, err)
+	assert.Greater(t, v2, v1)
+
+	// 舊版本號不能再用來刪除
+	assert.ErrorIs(t, bc.DeleteIf([]byte("lock"), v1), ErrVersionMismatch)
+	require.NoError(t, bc.DeleteIf([]byte("lock"), v2))
+	assert.ErrorIs(t, bc.DeleteIf([]byte("lock"), v2), ErrKeyNotFound)
+
+	// 版本號 0 表示預期 key 不存在
+	v3, err := bc.CompareAndSwap([]byte("lock"), 0, []byte("owner-c"))
+	require.NoError(t, err)
+	assert.Greater(t, v3, v2)
+	_, err = bc.CompareAndSwap([]byte("lock"), 0, []byte("owner-d"))
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+
+	// 租約過期後可以重新取得
+	_, err = bc.PutIfAbsentWithTTL([]byte("lease"), []byte("a"), time.Minute)
+	require.NoError(t, err)
+	clock.Advance(time.Minute - time.Nanosecond)
+	_, err = bc.PutIfAbsentWithTTL([]byte("lease"), []byte("b"), time.Minute)
+	assert.ErrorIs(t, err, ErrKeyExists)
+	clock.Advance(time.Nanosecond)
+	_, err = bc.PutIfAbsentWithTTL([]byte("lease"), []byte("b"), time.Minute)
+	assert.NoError(t, err)
+	value, err = bc.Get([]byte("lease"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("b"), value)
+
+	// 版本號隨資料一起保存，重新開啟與合併後不變
+	require.NoError(t, bc.Close())
+	bc = openTestBitcask(t, dir)
+	_, version, err = bc.GetWithVersion([]byte("lock"))
+	require.NoError(t, err)
+	assert.Equal(t, v3, version)
+	require.NoError(t, bc.Merge())
+	require.NoError(t, bc.Close())
+	bc = openTestBitcask(t, dir)
+	_, version, err = bc.GetWithVersion([]byte("lock"))
+	require.NoError(t, err)
+	assert.Equal(t, v3, version)
+
+	// 重新開啟後分配的版本號仍大於之前的版本號
+	v4, err := bc.CompareAndSwap([]byte("lock"), v3, []byte("owner-e"))
+	require.NoError(t, err)
+	assert.Greater(t, v4, v3)
+}
+
+func TestCompareAndSwapCounter(t *testing.T) {
+	bc := openTestBitcask(t, t.TempDir())
+
+	const workers, increments = 8, 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < increments; {
+				value, version, err := bc.GetWithVersion([]byte("counter"))
+				count := 0
+				if err == nil {
+					count, _ = strconv.Atoi(string(value))
+				} else if !assert.ErrorIs(t, err, ErrKeyNotFound) {
+					return
+				}
+
+				_, err = bc.CompareAndSwap([]byte("counter"), version, []byte(strconv.Itoa(count+1)))
+				if errors.Is(err, ErrVersionMismatch) {
+					continue
+				}
+				if !assert.NoError(t, err) {
+					return
+				}
+				n++
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, err := bc.Get([]byte("counter"))
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(workers*increments), string(value))
+}
+
+func TestStreaming(t *testing.T) {
+	dir := t.TempDir()
+	bc := openTestBitcask(t, dir, WithMaxFileSize(1<<20), WithCompression(FlateCompression))
+
+	// 超過資料段大小上限的 value 會獨佔一個資料段
+	const size = 3 << 20
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	require.NoError(t, bc.Put([]byte("small"), []byte("before")))
+	require.NoError(t, bc.PutStream([]byte("artifact"), bytes.NewReader(data), size))
+
+	r, err := bc.GetReader([]byte("artifact"))
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.True(t, bytes.Equal(data, got))
+
+	// 以一般方式寫入並壓縮的 value 也可以用 GetReader 讀取
+	require.NoError(t, bc.Put([]byte("compressed"), bytes.Repeat([]byte("x"), 1000)))
+	r, err = bc.GetReader([]byte("compressed"))
+	require.NoError(t, err)
+	got, err = io.ReadAll(r)
+	require.NoError(t, err)
+	r.Close()
+	assert.Equal(t, bytes.Repeat([]byte("x"), 1000), got)
+
+	// 來源提前結束時不留下寫到一半的資料，原本的值維持不變
+	err = bc.PutStream([]byte("small"), bytes.NewReader([]byte("short")), 100)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	value, err := bc.Get([]byte("small"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("before"), value)
+	require.NoError(t, bc.Put([]byte("after"), []byte("ok")))
+
+	// 已取得的 Reader 不受之後的刪除與合併影響
+	r, err = bc.GetReader([]byte("artifact"))
+	require.NoError(t, err)
+	require.NoError(t, bc.Delete([]byte("artifact")))
+	require.NoError(t, bc.Merge())
+	got, err = io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.True(t, bytes.Equal(data, got))
+
+	require.NoError(t, bc.Close())
+	bc = openTestBitcask(t, dir)
+	value, err = bc.Get([]byte("after"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("ok"), value)
+	_, err = bc.GetReader([]byte("artifact"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestStreamingDetectsCorruption(t *testing.T) {
+	dir := t.TempDir()
+	bc := openTestBitcask(t, dir)
+	require.NoError(t, bc.PutStream([]byte("key"), strings.NewReader("streamed value"), 14))
+
+	// 直接修改磁碟上的 value，讀到結尾時才會發現 CRC 不符
+	file, err := os.OpenFile(segmentPath(dir, 0), os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = file.WriteAt([]byte("S"), segmentHeaderSize+entryHeaderSize+3)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	r, err := bc.GetReader([]byte("key"))
+	require.NoError(t, err)
+	defer r.Close()
+	_, err = io.ReadAll(r)
+	var corrupt *ErrCorrupt
+	require.ErrorAs(t, err, &corrupt)
+	assert.ErrorIs(t, err, ErrChecksum)
+
+	// 分段加密的 value 在解密到被修改的分段時就會發現
+	dir = t.TempDir()
+	encrypted := openTestBitcask(t, dir, WithEncryption(bytes.Repeat([]byte("k"), 32), 1))
+	data := bytes.Repeat([]byte("v"), 3*streamChunkSize)
+	require.NoError(t, encrypted.PutStream([]byte("key"), bytes.NewReader(data), int64(len(data))))
+
+	file, err = os.OpenFile(segmentPath(dir, 0), os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = file.WriteAt([]byte("S"), segmentHeaderSize+entryHeaderSize+diskKeySize(3, FlagKeyEncrypted)+streamNoncePrefix+10)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	r, err = encrypted.GetReader([]byte("key"))
+	require.NoError(t, err)
+	defer r.Close()
+	n, err := io.Copy(io.Discard, r)
+	assert.ErrorIs(t, err, ErrAuthentication)
+	assert.Zero(t, n)
+}
+
+func TestStreamingEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	key := bytes.Repeat([]byte("k"), 32)
+	bc := openTestBitcask(t, dir, WithEncryption(key, 1))
+
+	// 涵蓋空的 value、剛好一段、跨越多段與最後一段不完整的情況
+	sizes := []int{0, 1, streamChunkSize, 2*streamChunkSize + 123}
+	values := make(map[string][]byte)
+	for _, size := range sizes {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i * 13)
+		}
+		k := fmt.Sprintf("stream-%d", size)
+		values[k] = data
+		require.NoError(t, bc.PutStream([]byte(k), bytes.NewReader(data), int64(size)))
+	}
+
+	check := func(bc *Bitcask) {
+		for k, data := range values {
+			r, err := bc.GetReader([]byte(k))
+			require.NoError(t, err)
+			got, err := io.ReadAll(r)
+			require.NoError(t, err)
+			require.NoError(t, r.Close())
+			assert.True(t, bytes.Equal(data, got), k)
+
+			value, err := bc.Get([]byte(k))
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(data, value), k)
+		}
+	}
+	check(bc)
+
+	// 來源提前結束時同樣不留下寫到一半的資料
+	err := bc.PutStream([]byte("stream-1"), bytes.NewReader([]byte("short")), 100)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	segment, err := os.ReadFile(segmentPath(dir, 0))
+	require.NoError(t, err)
+	assert.False(t, bytes.Contains(segment, []byte("stream-")))
+
+	require.NoError(t, bc.Merge())
+	check(bc)
+	require.NoError(t, bc.Close())
+
+	bc = openTestBitcask(t, dir, WithEncryption(key, 1), WithVerifyChecksum(true))
+	check(bc)
+}
+
+func TestFileHeader(t *testing.T) {
+	dir := t.TempDir()
+	bc, err := NewBitcask(dir)
+	require.NoError(t, err)
+	require.NoError(t, bc.Put([]byte("key"), []byte("value")))
+	require.NoError(t, bc.Close())
+
+	path := segmentPath(dir, 0)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("BCSK"), data[:4])
+	assert.Equal(t, uint32(formatVersion), binary.BigEndian.Uint32(data[4:8]))
+
+	// CRC 涵蓋標頭，只改動類型也會被發現
+	entry := NewEntry([]byte("key"), []byte("value"), PUT)
+	buf, err := entry.Encode()
+	require.NoError(t, err)
+	buf[13] = byte(DEL)
+	_, err = Decode(buf)
+	assert.ErrorIs(t, err, ErrChecksum)
+
+	// 檔頭損壞
+	corrupted := bytes.Clone(data)
+	corrupted[5] ^= 0x01
+	require.NoError(t, os.WriteFile(path, corrupted, 0644))
+	_, err = NewBitcask(dir)
+	var corrupt *ErrCorrupt
+	require.ErrorAs(t, err, &corrupt)
+	assert.ErrorIs(t, err, ErrChecksum)
+
+	// 比目前更新的格式版本
+	header := encodeFileHeader(segmentMagic)
+	binary.BigEndian.PutUint32(header[4:8], formatVersion+1)
+	binary.BigEndian.PutUint32(header[12:16], crc32.ChecksumIEEE(header[:12]))
+	require.NoError(t, os.WriteFile(path, append(header, data[segmentHeaderSize:]...), 0644))
+	_, err = NewBitcask(dir)
+	assert.ErrorIs(t, err, ErrFormat)
+}
+
+// encodeEntryV0 以沒有檔頭的版本 0 格式編碼 Entry，CRC 只涵蓋 key 與 value
+func encodeEntryV0(e *Entry) []byte {
+	buf := make([]byte, entryHeaderSize+len(e.Key)+len(e.Value))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(e.Key)))
+	binary.BigEndian.PutUint32(buf[4:8], uint32(len(e.Value)))
+	buf[8] = byte(e.Flags)
+	buf[9] = byte(e.Mark)
+	binary.BigEndian.PutUint32(buf[10:14], e.KeyID)
+	binary.BigEndian.PutUint32(buf[14:18], crc32.ChecksumIEEE(append(bytes.Clone(e.Key), e.Value...)))
+	binary.BigEndian.PutUint64(buf[18:26], uint64(e.Timestamp))
+	binary.BigEndian.PutUint64(buf[26:34], uint64(e.ExpiresAt))
+	binary.BigEndian.PutUint64(buf[34:42], e.Seq)
+	copy(buf[entryHeaderSize:], e.Key)
+	copy(buf[entryHeaderSize+len(e.Key):], e.Value)
+	return buf
+}
+
+func TestUpgradeUnversionedSegments(t *testing.T) {
+	dir := t.TempDir()
+	v0 := func(key, value string, mark EntryType, seq uint64) []byte {
+		e := NewEntry([]byte(key), []byte(value), mark)
+		e.Seq = seq
+		return encodeEntryV0(e)
+	}
+
+	sealed := append(v0("a", "1", PUT, 1), v0("b", "2", PUT, 2)...)
+	require.NoError(t, os.WriteFile(segmentPath(dir, 0), sealed, 0644))
+	require.NoError(t, os.WriteFile(hintPath(dir, 0), []byte("stale hint"), 0644))
+	active := append(v0("a", "", DEL, 3), v0("c", "3", PUT, 4)...)
+	active = append(active, v0("d", "torn", PUT, 5)[:20]...)
+	require.NoError(t, os.WriteFile(segmentPath(dir, 1), active, 0644))
+
+	_, err := NewBitcask(dir, WithReadOnly())
+	assert.ErrorIs(t, err, ErrFormat)
+
+	bc := openTestBitcask(t, dir)
+	_, err = bc.Get([]byte("a"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	_, version, err := bc.GetWithVersion([]byte("b"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), version)
+	value, err := bc.Get([]byte("c"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("3"), value)
+	_, err = bc.Get([]byte("d"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	// 升級前的日誌位置已經失效
+	_, err = bc.WatchFrom(nil, Position{Segment: 1, Offset: int64(len(active))})
+	assert.ErrorIs(t, err, ErrCompacted)
+
+	for _, id := range []uint32{0, 1} {
+		version, err := segmentVersion(segmentPath(dir, id))
+		require.NoError(t, err)
+		assert.Equal(t, uint32(formatVersion), version)
+	}
+	assert.False(t, fileExists(hintPath(dir, 0)))
+	require.NoError(t, bc.Put([]byte("e"), []byte("5")))
+	require.NoError(t, bc.Close())
+
+	report, err := Verify(dir)
+	require.NoError(t, err)
+	assert.True(t, report.OK())
+	assert.Equal(t, 5, report.Entries)
+
+	// 損壞的封存資料段無法升級
+	broken := t.TempDir()
+	data := v0("a", "1", PUT, 1)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(segmentPath(broken, 0), data, 0644))
+	require.NoError(t, os.WriteFile(segmentPath(broken, 1), v0("b", "2", PUT, 2), 0644))
+	_, err = NewBitcask(broken)
+	var corrupt *ErrCorrupt
+	require.ErrorAs(t, err, &corrupt)
+	assert.Equal(t, uint32(0), corrupt.Segment)
+}
+
+// encodeLegacyEntry 以舊版單檔資料庫的格式編碼一筆 Entry
+func encodeLegacyEntry(key, value string, mark EntryType) []byte {
+	buf := make([]byte, legacyHeaderSize+len(key)+len(value))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(key)))
+	binary.BigEndian.PutUint32(buf[4:8], uint32(len(value)))
+	binary.BigEndian.PutUint16(buf[8:10], uint16(mark))
+	binary.BigEndian.PutUint32(buf[10:14], crc32.ChecksumIEEE([]byte(key+value)))
+	copy(buf[legacyHeaderSize:], key+value)
+	return buf
+}
+
+func TestMigrateLegacyFile(t *testing.T) {
+	legacy := filepath.Join(t.TempDir(), "bitcask.db")
+	var data []byte
+	data = append(data, encodeLegacyEntry("a", "1", PUT)...)
+	data = append(data, encodeLegacyEntry("b", "2", PUT)...)
+	data = append(data, encodeLegacyEntry("a", "", DEL)...)
+	data = append(data, encodeLegacyEntry("b", "22", PUT)...)
+	data = append(data, encodeLegacyEntry("c", "torn", PUT)[:10]...)
+	require.NoError(t, os.WriteFile(legacy, data, 0644))
+
+	_, err := NewBitcask(legacy)
+	assert.ErrorIs(t, err, ErrFormat)
+
+	dir := filepath.Join(t.TempDir(), "data")
+	require.NoError(t, MigrateLegacyFile(legacy, dir))
+	assert.Error(t, MigrateLegacyFile(legacy, dir), "目的目錄已有資料")
+
+	bc := openTestBitcask(t, dir)
+	assert.Equal(t, []string{"b"}, bc.ListKeys())
+	value, err := bc.Get([]byte("b"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("22"), value)
+
+	data[legacyHeaderSize] ^= 0xff
+	require.NoError(t, os.WriteFile(legacy, data, 0644))
+	err = MigrateLegacyFile(legacy, t.TempDir())
+	assert.ErrorIs(t, err, ErrChecksum)
+}
@@ -0,0 +1,191 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrKeyExists 表示 PutIfAbsent 的 key 已經存在
+	ErrKeyExists = errors.New("key already exists")
+	// ErrVersionMismatch 表示 key 目前的版本號與預期不符
+	ErrVersionMismatch = errors.New("version mismatch")
+	// ErrConditionFailed 表示 PutIfCRC 或 DeleteIfCRC 的條件不成立
+	ErrConditionFailed = errors.New("condition failed")
+)
+
+// GetWithVersion 取得 key 的最新值與目前的版本號。
+// 版本號為寫入 key 時分配的序號，每次寫入都不同且遞增，可傳給 CompareAndSwap 與 DeleteIf。
+func (bc *Bitcask) GetWithVersion(key []byte) ([]byte, uint64, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if bc.closed {
+		return nil, 0, ErrClosed
+	}
+
+	pos, exists := bc.keyDir.Get(string(key))
+	if !exists {
+		return nil, 0, ErrKeyNotFound
+	}
+	value, err := readValue(bc.segment(pos.FileID), bc.codec, key, pos, bc.opts.VerifyChecksum)
+	if err != nil {
+		return nil, 0, err
+	}
+	return value, pos.Seq, nil
+}
+
+// PutIfAbsent 只在 key 不存在（或已過期）時寫入，返回新的版本號；key 已存在時返回 ErrKeyExists
+func (bc *Bitcask) PutIfAbsent(key, value []byte) (uint64, error) {
+	return bc.putIfAbsent(key, value, 0)
+}
+
+// PutIfAbsentWithTTL 與 PutIfAbsent 相同，但寫入的 key 在 ttl 之後過期，適合用來實作租約
+func (bc *Bitcask) PutIfAbsentWithTTL(key, value []byte, ttl time.Duration) (uint64, error) {
+	if ttl <= 0 {
+		return 0, fmt.Errorf("%w %v", ErrInvalidTTL, ttl)
+	}
+	return bc.putIfAbsent(key, value, bc.opts.now().Add(ttl).UnixNano())
+}
+
+func (bc *Bitcask) putIfAbsent(key, value []byte, expiresAt int64) (uint64, error) {
+	bc.writeMu.Lock()
+	defer bc.writeMu.Unlock()
+
+	if err := bc.checkWritable(); err != nil {
+		return 0, err
+	}
+	if _, exists := bc.keyDir.Get(string(key)); exists {
+		return 0, ErrKeyExists
+	}
+	return bc.putLocked(key, value, expiresAt)
+}
+
+// CompareAndSwap 只在 key 目前的版本號等於 expected 時寫入 value，返回新的版本號。
+// expected 為 0 表示預期 key 不存在；版本號不符時返回 ErrVersionMismatch。
+// 比對與寫入在同一個寫入鎖內完成，中間不會有其他寫入插入。
+// 寫入的 value 永不過期，原本設定的存活時間不會保留。
+func (bc *Bitcask) CompareAndSwap(key []byte, expected uint64, value []byte) (uint64, error) {
+	bc.writeMu.Lock()
+	defer bc.writeMu.Unlock()
+
+	if err := bc.checkWritable(); err != nil {
+		return 0, err
+	}
+	if err := bc.checkVersion(key, expected); err != nil {
+		return 0, err
+	}
+	return bc.putLocked(key, value, 0)
+}
+
+// DeleteIf 只在 key 目前的版本號等於 expected 時刪除；
+// key 不存在時返回 ErrKeyNotFound，版本號不符時返回 ErrVersionMismatch
+func (bc *Bitcask) DeleteIf(key []byte, expected uint64) error {
+	bc.writeMu.Lock()
+	defer bc.writeMu.Unlock()
+
+	if err := bc.checkWritable(); err != nil {
+		return err
+	}
+	if _, exists := bc.keyDir.Get(string(key)); !exists {
+		return ErrKeyNotFound
+	}
+	if err := bc.checkVersion(key, expected); err != nil {
+		return err
+	}
+	return bc.deleteLocked(key)
+}
+
+// checkVersion 比對 key 目前的版本號，呼叫前需持有 writeMu
+func (bc *Bitcask) checkVersion(key []byte, expected uint64) error {
+	var current uint64
+	if pos, exists := bc.keyDir.Get(string(key)); exists {
+		current = pos.Seq
+	}
+	if current != expected {
+		return fmt.Errorf("%w: key %q is at version %d, expected %d", ErrVersionMismatch, key, current, expected)
+	}
+	return nil
+}
+
+// CRCCondition 判斷條件式寫入是否成立。crc 為 key 目前的 Entry CRC（與 GetWithCRC 相同），
+// exists 為 false 表示 key 不存在或已過期，此時 crc 為 0。
+type CRCCondition func(crc uint32, exists bool) bool
+
+// PutIfCRC 只在 cond 對 key 目前的 CRC 成立時寫入 value，ttl 大於 0 時設定存活時間；
+// 條件不成立時返回 ErrConditionFailed。
+// 讀取 CRC、判斷與寫入在同一個寫入鎖內完成，可用來實作 HTTP 的 If-Match / If-None-Match。
+func (bc *Bitcask) PutIfCRC(key, value []byte, ttl time.Duration, cond CRCCondition) error {
+	if ttl < 0 {
+		return fmt.Errorf("%w %v", ErrInvalidTTL, ttl)
+	}
+
+	bc.writeMu.Lock()
+	defer bc.writeMu.Unlock()
+
+	if err := bc.checkWritable(); err != nil {
+		return err
+	}
+	if _, err := bc.checkCRC(key, cond); err != nil {
+		return err
+	}
+
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = bc.opts.now().Add(ttl).UnixNano()
+	}
+	_, err := bc.putLocked(key, value, expiresAt)
+	return err
+}
+
+// DeleteIfCRC 只在 cond 對 key 目前的 CRC 成立時刪除；
+// 條件不成立時返回 ErrConditionFailed，條件成立但 key 不存在時返回 ErrKeyNotFound
+func (bc *Bitcask) DeleteIfCRC(key []byte, cond CRCCondition) error {
+	bc.writeMu.Lock()
+	defer bc.writeMu.Unlock()
+
+	if err := bc.checkWritable(); err != nil {
+		return err
+	}
+	exists, err := bc.checkCRC(key, cond)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrKeyNotFound
+	}
+	return bc.deleteLocked(key)
+}
+
+// checkCRC 讀出 key 目前的 CRC 並以 cond 判斷，返回 key 是否存在，呼叫前需持有 writeMu
+func (bc *Bitcask) checkCRC(key []byte, cond CRCCondition) (bool, error) {
+	crc, exists, err := bc.currentCRC(key)
+	if err != nil {
+		return false, err
+	}
+	if !cond(crc, exists) {
+		return exists, fmt.Errorf("%w: key %q", ErrConditionFailed, key)
+	}
+	return exists, nil
+}
+
+// currentCRC 返回 key 目前 Entry 的 CRC，並校驗整筆 Entry
+func (bc *Bitcask) currentCRC(key []byte) (uint32, bool, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	pos, exists := bc.keyDir.Get(string(key))
+	if !exists {
+		return 0, false, nil
+	}
+	seg := bc.segment(pos.FileID)
+	if seg == nil {
+		return 0, false, fmt.Errorf("segment %d not found", pos.FileID)
+	}
+	entry, err := readVerifiedEntry(seg, bc.codec, key, pos)
+	if err != nil {
+		return 0, false, err
+	}
+	return entry.CRC, true, nil
+}
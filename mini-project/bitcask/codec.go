@@ -0,0 +1,227 @@
+package bitcask
+
+import (
+	"crypto/cipher"
+	"fmt"
+)
+
+// EntryFlag 記錄 Entry 中 value 的編碼方式，與 Mark 共用標頭中的兩個位元組
+type EntryFlag uint8
+
+const (
+	FlagCompressed   EntryFlag = 1 << iota // value 以 flate 壓縮
+	FlagEncrypted                          // value 以 AES-GCM 加密，金鑰編號記錄在標頭的 KeyID
+	FlagKeyEncrypted                       // key 以 AES-GCM 加密，與 value 使用同一把金鑰
+	FlagChunked                            // 與 FlagEncrypted 一起使用，value 以串流寫入並分段加密
+)
+
+// knownFlags 為目前版本能夠解讀的所有旗標
+const knownFlags = FlagCompressed | FlagEncrypted | FlagKeyEncrypted | FlagChunked
+
+// diskKeySize 返回長度為 keySize 的 key 以 flags 寫入日誌後的長度
+func diskKeySize(keySize int, flags EntryFlag) int64 {
+	if flags&FlagKeyEncrypted != 0 {
+		return int64(keySize) + sealOverhead
+	}
+	return int64(keySize)
+}
+
+// valueCodec 負責 key 與 value 寫入日誌前的壓縮與加密，以及讀取時的還原。
+// value 寫入時先壓縮再加密；啟用加密時 key 也會加密，日誌與提示檔中都不會出現明文的 key。
+// 讀取時依 Entry 的旗標與金鑰編號反向處理，因此不同設定下寫入的 Entry 可以混合存在。
+type valueCodec struct {
+	compression Compression
+	keyID       uint32                 // 寫入時使用的金鑰編號
+	sealer      cipher.AEAD            // 寫入時使用的金鑰，nil 表示不加密
+	keys        map[uint32]cipher.AEAD // 讀取時可用的所有金鑰
+}
+
+// newValueCodec 依設定建立 valueCodec，金鑰長度錯誤或編號重複時返回錯誤
+func newValueCodec(opts Options) (*valueCodec, error) {
+	c := &valueCodec{
+		compression: opts.Compression,
+		keys:        make(map[uint32]cipher.AEAD),
+	}
+
+	for id, key := range opts.DecryptionKeys {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid decryption key %d: %v", id, err)
+		}
+		c.keys[id] = aead
+	}
+
+	if opts.EncryptionKey != nil {
+		if _, ok := opts.DecryptionKeys[opts.EncryptionKeyID]; ok {
+			return nil, fmt.Errorf("key id %d is used by both the encryption key and a decryption key", opts.EncryptionKeyID)
+		}
+		aead, err := newAEAD(opts.EncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key: %v", err)
+		}
+		c.keyID = opts.EncryptionKeyID
+		c.sealer = aead
+		c.keys[c.keyID] = aead
+	}
+	return c, nil
+}
+
+// encode 將 value 編碼為寫入日誌的資料，返回對應的旗標與金鑰編號
+func (c *valueCodec) encode(key, value []byte) ([]byte, EntryFlag, uint32, error) {
+	var flags EntryFlag
+	data := value
+
+	if c.compression == FlateCompression {
+		compressed, ok, err := compressValue(data)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if ok {
+			data = compressed
+			flags |= FlagCompressed
+		}
+	}
+
+	if c.sealer == nil {
+		return data, flags, 0, nil
+	}
+	sealed, err := sealValue(c.sealer, key, data)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return sealed, flags | FlagEncrypted, c.keyID, nil
+}
+
+// decode 依旗標與金鑰編號還原日誌中保存的 value
+func (c *valueCodec) decode(key []byte, flags EntryFlag, keyID uint32, data []byte) ([]byte, error) {
+	if flags&^knownFlags != 0 {
+		return nil, fmt.Errorf("unsupported entry flags %#x", uint8(flags))
+	}
+
+	value := data
+	if flags&FlagEncrypted != 0 {
+		aead, ok := c.keys[keyID]
+		if !ok {
+			return nil, fmt.Errorf("%w: no key for key id %d", ErrAuthentication, keyID)
+		}
+		var err error
+		if flags&FlagChunked != 0 {
+			value, err = openStream(aead, keyID, key, value)
+		} else {
+			value, err = openValue(aead, keyID, key, value)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if flags&FlagCompressed != 0 {
+		return decompressValue(value)
+	}
+	return value, nil
+}
+
+// encodeKey 依目前的設定編碼寫入日誌的 key，返回需要加入 Entry 的旗標
+func (c *valueCodec) encodeKey(key []byte) ([]byte, EntryFlag, error) {
+	if c.sealer == nil {
+		return key, 0, nil
+	}
+	sealed, err := sealValue(c.sealer, keyAAD, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return sealed, FlagKeyEncrypted, nil
+}
+
+// decodeKey 依旗標與金鑰編號還原日誌或提示檔中保存的 key
+func (c *valueCodec) decodeKey(flags EntryFlag, keyID uint32, data []byte) ([]byte, error) {
+	if flags&FlagKeyEncrypted == 0 {
+		return data, nil
+	}
+	aead, ok := c.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: no key for key id %d", ErrAuthentication, keyID)
+	}
+	return openValue(aead, keyID, keyAAD, data)
+}
+
+// entryKey 返回從日誌讀出的 Entry 的明文 key
+func (c *valueCodec) entryKey(e *Entry) ([]byte, error) {
+	return c.decodeKey(e.Flags, e.KeyID, e.Key)
+}
+
+// newEntry 依目前的設定建立寫入日誌的 PUT 或 DEL Entry
+func (c *valueCodec) newEntry(key, value []byte, mark EntryType) (*Entry, error) {
+	var (
+		data  []byte
+		flags EntryFlag
+		keyID uint32
+		err   error
+	)
+	if mark == PUT {
+		if data, flags, keyID, err = c.encode(key, value); err != nil {
+			return nil, err
+		}
+	}
+
+	diskKey, keyFlags, err := c.encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if keyFlags != 0 {
+		flags |= keyFlags
+		keyID = c.keyID
+	}
+
+	entry := NewEntry(diskKey, data, mark)
+	entry.Flags = flags
+	entry.KeyID = keyID
+	return entry, nil
+}
+
+// current 判斷以 flags 與 keyID 編碼的 Entry 是否已經符合目前的設定
+func (c *valueCodec) current(flags EntryFlag, keyID uint32) bool {
+	if (flags&FlagEncrypted != 0) != (c.sealer != nil) || (flags&FlagKeyEncrypted != 0) != (c.sealer != nil) {
+		return false
+	}
+	if c.sealer != nil && keyID != c.keyID {
+		return false
+	}
+	return (flags&FlagCompressed != 0) == (c.compression == FlateCompression)
+}
+
+// transcode 在合併時將 Entry 的 value 轉換為目前的壓縮與加密設定，
+// 已經符合設定的 Entry 原樣返回
+func (c *valueCodec) transcode(e *Entry) (*Entry, error) {
+	if e.Mark != PUT || c.current(e.Flags, e.KeyID) {
+		return e, nil
+	}
+
+	key, err := c.entryKey(e)
+	if err != nil {
+		return nil, err
+	}
+	value, err := c.decode(key, e.Flags, e.KeyID, e.Value)
+	if err != nil {
+		return nil, err
+	}
+	out, err := c.newEntry(key, value, PUT)
+	if err != nil {
+		return nil, err
+	}
+
+	out.Timestamp = e.Timestamp
+	out.ExpiresAt = e.ExpiresAt
+	out.Seq = e.Seq
+	return out, nil
+}
+
+// newPutEntry 依資料庫的壓縮與加密設定建立一筆 PUT Entry
+func (bc *Bitcask) newPutEntry(key, value []byte) (*Entry, error) {
+	return bc.codec.newEntry(key, value, PUT)
+}
+
+// newDeleteEntry 依資料庫的加密設定建立一筆 DEL Entry
+func (bc *Bitcask) newDeleteEntry(key []byte) (*Entry, error) {
+	return bc.codec.newEntry(key, nil, DEL)
+}
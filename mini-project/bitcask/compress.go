@@ -0,0 +1,59 @@
+package bitcask
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Compression 決定寫入時 value 的壓縮方式
+type Compression int
+
+const (
+	NoCompression    Compression = iota // 不壓縮（預設）
+	FlateCompression                    // 以 compress/flate 壓縮
+)
+
+// flateWriters 重複使用 flate.Writer，避免每次寫入都配置壓縮器的內部緩衝區
+var flateWriters = sync.Pool{
+	New: func() any {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	},
+}
+
+// compressValue 以 flate 壓縮 value，壓縮後沒有變小時返回 false
+func compressValue(value []byte) ([]byte, bool, error) {
+	if len(value) == 0 {
+		return value, false, nil
+	}
+
+	var buf bytes.Buffer
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(&buf)
+	if _, err := w.Write(value); err != nil {
+		return nil, false, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, false, err
+	}
+
+	if buf.Len() >= len(value) {
+		return value, false, nil
+	}
+	return buf.Bytes(), true, nil
+}
+
+// decompressValue 解壓縮以 flate 壓縮的 value
+func decompressValue(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+	value, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing value: %v", err)
+	}
+	return value, nil
+}
@@ -0,0 +1,51 @@
+package bitcask
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// ErrAuthentication 表示加密的 value 無法通過 AES-GCM 驗證，
+// 通常代表使用了錯誤的金鑰、缺少對應編號的金鑰，或資料遭到竄改
+var ErrAuthentication = errors.New("authentication failed")
+
+// sealOverhead 為 sealValue 輸出比明文多出的長度：AES-GCM 標準的 12 位元組 nonce 加上 16 位元組驗證標籤
+const sealOverhead = 12 + 16
+
+// keyAAD 為加密 key 時的附加驗證資料，避免加密的 key 被當成 value 解密
+var keyAAD = []byte("bitcask key")
+
+// newAEAD 以 AES-GCM 建立加解密器，key 長度需為 16、24 或 32 位元組
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealValue 以 AES-GCM 加密 value，key 作為附加驗證資料，
+// 避免密文被搬到其他 key 之下仍能通過驗證。輸出格式為 nonce + 密文。
+func sealValue(aead cipher.AEAD, key, value []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, value, key), nil
+}
+
+// openValue 解密 sealValue 的輸出，驗證失敗時返回包裝 ErrAuthentication 的錯誤
+func openValue(aead cipher.AEAD, keyID uint32, key, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("%w: encrypted value too short", ErrAuthentication)
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	value, err := aead.Open(nil, nonce, ciphertext, key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: wrong key for key id %d or tampered data", ErrAuthentication, keyID)
+	}
+	return value, nil
+}
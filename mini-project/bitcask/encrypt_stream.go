@@ -0,0 +1,170 @@
+package bitcask
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// 分段加密的 value 格式：nonce 前綴(7) + 每段的密文與驗證標籤。
+// 每段明文固定為 streamChunkSize，最後一段可以較短（value 為空時只有一段空的明文）。
+// 每段的 nonce 為前綴 + 段序號(4) + 最後一段標記(1)，段落被重排、刪除或截斷都無法通過驗證。
+const (
+	streamChunkSize   = 64 << 10
+	streamNoncePrefix = 7
+	streamTagSize     = 16
+)
+
+// sealedStreamSize 返回長度為 size 的 value 分段加密後的長度
+func sealedStreamSize(size int64) int64 {
+	chunks := max((size+streamChunkSize-1)/streamChunkSize, 1)
+	return streamNoncePrefix + size + chunks*streamTagSize
+}
+
+// streamNonce 組出第 counter 段的 nonce
+func streamNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, streamNoncePrefix+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[streamNoncePrefix:], counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// sealStream 從 r 讀出剛好 size 個位元組，分段加密後寫入 w，key 作為每一段的附加驗證資料
+func sealStream(aead cipher.AEAD, key []byte, w io.Writer, r io.Reader, size int64) error {
+	prefix := make([]byte, streamNoncePrefix)
+	if _, err := rand.Read(prefix); err != nil {
+		return err
+	}
+	if _, err := w.Write(prefix); err != nil {
+		return err
+	}
+
+	buf := make([]byte, min(size, streamChunkSize), min(size, streamChunkSize)+streamTagSize)
+	var read int64
+	for counter := uint32(0); ; counter++ {
+		chunk := buf[:min(size-read, streamChunkSize)]
+		n, err := io.ReadFull(r, chunk)
+		read += int64(n)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("value ended after %d of %d bytes: %w", read, size, io.ErrUnexpectedEOF)
+		}
+		if err != nil {
+			return err
+		}
+
+		last := read == size
+		if _, err := w.Write(aead.Seal(chunk[:0], streamNonce(prefix, counter, last), chunk, key)); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// openStream 解密整個分段加密的 value，驗證失敗時返回包裝 ErrAuthentication 的錯誤
+func openStream(aead cipher.AEAD, keyID uint32, key, data []byte) ([]byte, error) {
+	r := newStreamReader(aead, keyID, key, io.NopCloser(bytes.NewReader(data)), int64(len(data)))
+	value, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// streamReader 從 src 逐段讀出並解密分段加密的 value
+type streamReader struct {
+	aead      cipher.AEAD
+	keyID     uint32
+	key       []byte
+	src       io.ReadCloser
+	remaining int64 // src 中尚未讀出的密文長度
+	prefix    []byte
+	counter   uint32
+	buf       []byte
+	plain     []byte // 已解密但尚未交給呼叫者的明文
+	err       error
+}
+
+// newStreamReader 建立從 src 讀取長度為 size 的分段加密 value 的 Reader，Close 時一併關閉 src
+func newStreamReader(aead cipher.AEAD, keyID uint32, key []byte, src io.ReadCloser, size int64) *streamReader {
+	return &streamReader{aead: aead, keyID: keyID, key: key, src: src, remaining: size}
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.plain) == 0 && s.err == nil {
+		s.err = s.next()
+	}
+	if len(s.plain) > 0 {
+		n := copy(p, s.plain)
+		s.plain = s.plain[n:]
+		return n, nil
+	}
+	return 0, s.err
+}
+
+// next 讀出並解密下一段，最後一段解密後返回 io.EOF 之外的錯誤都代表資料損壞或金鑰錯誤
+func (s *streamReader) next() error {
+	if s.prefix == nil {
+		if s.remaining < streamNoncePrefix+streamTagSize {
+			return fmt.Errorf("%w: encrypted value too short", ErrAuthentication)
+		}
+		s.prefix = make([]byte, streamNoncePrefix)
+		if err := s.readFull(s.prefix); err != nil {
+			return err
+		}
+		s.buf = make([]byte, min(s.remaining, streamChunkSize+streamTagSize))
+	}
+	if s.remaining == 0 {
+		return io.EOF
+	}
+
+	chunk := s.buf[:min(s.remaining, streamChunkSize+streamTagSize)]
+	if err := s.readFull(chunk); err != nil {
+		return err
+	}
+	last := s.remaining == 0
+	if last {
+		// 讀到來源的結尾，讓來源有機會回報 CRC 等錯誤
+		if _, err := s.src.Read(make([]byte, 1)); err != io.EOF {
+			if err == nil {
+				err = fmt.Errorf("%w: encrypted value longer than expected", ErrAuthentication)
+			}
+			return err
+		}
+	}
+	if len(chunk) < streamTagSize {
+		return fmt.Errorf("%w: truncated encrypted chunk", ErrAuthentication)
+	}
+
+	plain, err := s.aead.Open(chunk[:0], streamNonce(s.prefix, s.counter, last), chunk, s.key)
+	if err != nil {
+		return fmt.Errorf("%w: wrong key for key id %d or tampered data", ErrAuthentication, s.keyID)
+	}
+	s.counter++
+	s.plain = plain
+	return nil
+}
+
+// readFull 從來源讀滿 p，並更新剩餘長度
+func (s *streamReader) readFull(p []byte) error {
+	if _, err := io.ReadFull(s.src, p); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	s.remaining -= int64(len(p))
+	return nil
+}
+
+func (s *streamReader) Close() error {
+	return s.src.Close()
+}
@@ -3,25 +3,59 @@ package bitcask
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"hash/crc32"
+	"time"
 )
 
-const entryHeaderSize = 14
+var (
+	// ErrChecksum 表示 Entry 的 CRC 校驗失敗
+	ErrChecksum = errors.New("CRC mismatch")
+	// ErrTruncated 表示資料長度不足以解碼一筆完整的 Entry
+	ErrTruncated = errors.New("truncated entry")
+)
+
+// Entry 標頭：CRC(4) + KeySize(4) + ValueSize(4) + Flags(1) + Mark(1) + KeyID(4) + Timestamp(8) + ExpiresAt(8) + Seq(8)
+// CRC 涵蓋其後的標頭欄位、key 與 value
+const entryHeaderSize = 42
 
 type EntryType uint16
 
 const (
 	PUT EntryType = iota
 	DEL
+	BATCH_BEGIN  // 批次開始標記
+	BATCH_COMMIT // 批次提交標記，批次內的操作在遇到此標記後才生效
 )
 
+// String 返回 Entry 類型的名稱
+func (t EntryType) String() string {
+	switch t {
+	case PUT:
+		return "PUT"
+	case DEL:
+		return "DEL"
+	case BATCH_BEGIN:
+		return "BATCH_BEGIN"
+	case BATCH_COMMIT:
+		return "BATCH_COMMIT"
+	default:
+		return fmt.Sprintf("EntryType(%d)", uint16(t))
+	}
+}
+
 type Entry struct {
 	Key       []byte
 	Value     []byte
 	KeySize   uint32
 	ValueSize uint32
 	Mark      EntryType // 墓碑，用於標記是否已刪除
+	Flags     EntryFlag // value 的編碼方式，例如是否經過壓縮或加密
+	KeyID     uint32    // 加密 value 所用的金鑰編號，未加密時為 0
 	CRC       uint32    // CRC 校驗碼
+	Timestamp int64     // 寫入時間 (UnixNano)
+	ExpiresAt int64     // 過期時間 (UnixNano)，0 表示永不過期
+	Seq       uint64    // 寫入序號，每次寫入遞增，作為 key 的版本號；批次標記為 0
 }
 
 // NewEntry 初始化並返回一個新的 Entry
@@ -33,12 +67,32 @@ func NewEntry(key, value []byte, mark EntryType) *Entry {
 		ValueSize: uint32(len(value)),
 		Mark:      mark,
 		CRC:       0,
+		Timestamp: time.Now().UnixNano(),
 	}
 }
 
-// CalculateCRC 計算並返回 Entry 的 CRC 校驗碼
+// IsExpired 判斷 Entry 在 now (UnixNano) 時是否已經過期
+func (e *Entry) IsExpired(now int64) bool {
+	return isExpired(e.ExpiresAt, now)
+}
+
+// isExpired 判斷過期時間 expiresAt 在 now 時是否已經到期，0 表示永不過期
+func isExpired(expiresAt, now int64) bool {
+	return expiresAt != 0 && expiresAt <= now
+}
+
+// Size 返回 Entry 編碼後的總長度
+func (e *Entry) Size() int64 {
+	return entryHeaderSize + int64(e.KeySize) + int64(e.ValueSize)
+}
+
+// CalculateCRC 計算並返回 Entry 的 CRC 校驗碼，涵蓋 CRC 之後的標頭欄位、key 與 value
 func (e *Entry) CalculateCRC() uint32 {
+	header := make([]byte, entryHeaderSize)
+	e.encodeHeader(header)
+
 	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
 	crc.Write(e.Key)
 	crc.Write(e.Value)
 	return crc.Sum32()
@@ -48,48 +102,61 @@ func (e *Entry) CalculateCRC() uint32 {
 func (e *Entry) Encode() ([]byte, error) {
 	buf := make([]byte, entryHeaderSize+e.KeySize+e.ValueSize)
 
-	e.CRC = e.CalculateCRC()
-	binary.BigEndian.PutUint32(buf[0:4], e.KeySize)
-	binary.BigEndian.PutUint32(buf[4:8], e.ValueSize)
-	binary.BigEndian.PutUint16(buf[8:10], uint16(e.Mark))
-	binary.BigEndian.PutUint32(buf[10:14], e.CRC)
-
+	e.encodeHeader(buf)
 	copy(buf[entryHeaderSize:entryHeaderSize+e.KeySize], e.Key)
 	copy(buf[entryHeaderSize+e.KeySize:], e.Value)
 
+	e.CRC = crc32.ChecksumIEEE(buf[4:])
+	binary.BigEndian.PutUint32(buf[0:4], e.CRC)
+
 	return buf, nil
 }
 
+// encodeHeader 將 Entry 的標頭（包含目前的 CRC 欄位）寫入 buf 的前 entryHeaderSize 個位元組
+func (e *Entry) encodeHeader(buf []byte) {
+	binary.BigEndian.PutUint32(buf[0:4], e.CRC)
+	binary.BigEndian.PutUint32(buf[4:8], e.KeySize)
+	binary.BigEndian.PutUint32(buf[8:12], e.ValueSize)
+	buf[12] = byte(e.Flags)
+	buf[13] = byte(e.Mark)
+	binary.BigEndian.PutUint32(buf[14:18], e.KeyID)
+	binary.BigEndian.PutUint64(buf[18:26], uint64(e.Timestamp))
+	binary.BigEndian.PutUint64(buf[26:34], uint64(e.ExpiresAt))
+	binary.BigEndian.PutUint64(buf[34:42], e.Seq)
+}
+
 // Decode 將字節數組解碼為 Entry
 func Decode(buf []byte) (*Entry, error) {
 	if len(buf) < entryHeaderSize {
-		return nil, errors.New("buffer too small to decode Entry")
+		return nil, ErrTruncated
 	}
 
-	ks := binary.BigEndian.Uint32(buf[0:4])
-	vs := binary.BigEndian.Uint32(buf[4:8])
-	mark := binary.BigEndian.Uint16(buf[8:10])
-	crc := binary.BigEndian.Uint32(buf[10:14])
-
-	if len(buf) < int(entryHeaderSize+ks+vs) {
-		return nil, errors.New("buffer size mismatch")
+	entry := &Entry{}
+	entry.decodeHeader(buf)
+	ks, vs := int64(entry.KeySize), int64(entry.ValueSize)
+	if int64(len(buf)) < entryHeaderSize+ks+vs {
+		return nil, ErrTruncated
 	}
 
-	key := buf[entryHeaderSize : entryHeaderSize+ks]
-	value := buf[entryHeaderSize+ks : entryHeaderSize+ks+vs]
+	entry.Key = buf[entryHeaderSize : entryHeaderSize+ks]
+	entry.Value = buf[entryHeaderSize+ks : entryHeaderSize+ks+vs]
 
-	entry := &Entry{
-		Key:       key,
-		Value:     value,
-		KeySize:   ks,
-		ValueSize: vs,
-		Mark:      EntryType(mark),
-		CRC:       crc,
-	}
-
-	if entry.CalculateCRC() != crc {
-		return nil, errors.New("CRC mismatch")
+	if crc32.ChecksumIEEE(buf[4:entryHeaderSize+ks+vs]) != entry.CRC {
+		return nil, ErrChecksum
 	}
 
 	return entry, nil
 }
+
+// decodeHeader 從 buf 的前 entryHeaderSize 個位元組解碼標頭欄位，不包含 key 與 value
+func (e *Entry) decodeHeader(buf []byte) {
+	e.CRC = binary.BigEndian.Uint32(buf[0:4])
+	e.KeySize = binary.BigEndian.Uint32(buf[4:8])
+	e.ValueSize = binary.BigEndian.Uint32(buf[8:12])
+	e.Flags = EntryFlag(buf[12])
+	e.Mark = EntryType(buf[13])
+	e.KeyID = binary.BigEndian.Uint32(buf[14:18])
+	e.Timestamp = int64(binary.BigEndian.Uint64(buf[18:26]))
+	e.ExpiresAt = int64(binary.BigEndian.Uint64(buf[26:34]))
+	e.Seq = binary.BigEndian.Uint64(buf[34:42])
+}
@@ -31,3 +31,39 @@ func ReplaceFile(src, dst string) error {
 
 	return os.Remove(src)
 }
+
+// moveFile 將 src 移動到 dst，若 os.Rename 因跨設備等原因失敗則改用 ReplaceFile 複製。
+// 複製前先刪除 dst，仍開啟著舊 dst 的讀取者會繼續看到原本的內容而不是被截斷的檔案。
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	if err := removeIfExists(dst); err != nil {
+		return err
+	}
+	return ReplaceFile(src, dst)
+}
+
+// fileExists 判斷檔案是否存在
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// removeIfExists 刪除檔案，檔案不存在時不視為錯誤
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// syncDir 將目錄本身同步到磁碟，確保新建立的檔案項目不會在當機後遺失
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,273 @@
+package bitcask
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// formatVersion 為目前寫入的檔案格式版本。
+// 版本 0 為沒有檔頭的資料段，Entry 的 CRC 只涵蓋 key 與 value；
+// 版本 1 加入檔頭，並將 CRC 移到 Entry 開頭，涵蓋其後的標頭欄位、key 與 value。
+const formatVersion = 1
+
+// 檔頭：Magic(4) + Version(4) + Reserved(4) + CRC(4)，CRC 涵蓋前 12 個位元組
+const fileHeaderSize = 16
+
+// segmentHeaderSize 為資料段的檔頭長度，第一筆 Entry 從此偏移量開始
+const segmentHeaderSize = fileHeaderSize
+
+var (
+	segmentMagic = [4]byte{'B', 'C', 'S', 'K'}
+	hintMagic    = [4]byte{'B', 'C', 'H', 'T'}
+)
+
+// ErrFormat 表示檔案的格式無法辨識，或格式版本需要升級或比目前支援的更新
+var ErrFormat = errors.New("unsupported file format")
+
+// encodeFileHeader 編碼目前版本的檔頭
+func encodeFileHeader(magic [4]byte) []byte {
+	buf := make([]byte, fileHeaderSize)
+	copy(buf[0:4], magic[:])
+	binary.BigEndian.PutUint32(buf[4:8], formatVersion)
+	binary.BigEndian.PutUint32(buf[12:16], crc32.ChecksumIEEE(buf[:12]))
+	return buf
+}
+
+// readFileVersion 讀取並校驗檔頭，返回格式版本。
+// 檔案長度不足或開頭不是 magic 時視為沒有檔頭的版本 0；檔頭 CRC 不符時返回 ErrChecksum。
+func readFileVersion(r io.ReaderAt, size int64, magic [4]byte) (uint32, error) {
+	if size < fileHeaderSize {
+		return 0, nil
+	}
+
+	buf := make([]byte, fileHeaderSize)
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		return 0, err
+	}
+	if [4]byte(buf[0:4]) != magic {
+		return 0, nil
+	}
+	if crc32.ChecksumIEEE(buf[:12]) != binary.BigEndian.Uint32(buf[12:16]) {
+		return 0, fmt.Errorf("file header: %w", ErrChecksum)
+	}
+	return binary.BigEndian.Uint32(buf[4:8]), nil
+}
+
+// checkFileVersion 確認檔案為目前的格式版本
+func checkFileVersion(path string, version uint32) error {
+	switch {
+	case version == 0:
+		return fmt.Errorf("%w: %s has no file header and must be upgraded by a read-write open", ErrFormat, path)
+	case version > formatVersion:
+		return fmt.Errorf("%w: %s has format version %d, newer than supported version %d", ErrFormat, path, version, formatVersion)
+	case version != formatVersion:
+		return fmt.Errorf("%w: %s has unknown format version %d", ErrFormat, path, version)
+	}
+	return nil
+}
+
+// segmentVersion 返回資料段檔案的格式版本，沒有檔頭時為 0
+func segmentVersion(path string) (uint32, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return readFileVersion(file, info.Size(), segmentMagic)
+}
+
+// 升級資料段時的暫存檔副檔名，完成後改名覆蓋原本的資料段
+const upgradeFileExt = ".upgrade"
+
+// upgradeSegments 將目錄中沒有檔頭的版本 0 資料段就地改寫為目前的格式。
+// 每個資料段先寫入暫存檔、同步後再改名覆蓋，中途當機時下次開啟會從尚未升級的資料段繼續。
+// 返回最後一個被升級的資料段編號加一，0 表示沒有任何資料段需要升級；
+// 升級後 Entry 的偏移量都會改變，之前取得的日誌位置不再有效。
+func upgradeSegments(dir string) (uint32, error) {
+	ids, err := listSegmentIDs(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var upgraded uint32
+	for i, id := range ids {
+		version, err := segmentVersion(segmentPath(dir, id))
+		if err != nil {
+			return 0, &ErrCorrupt{Segment: id, Offset: 0, Err: err}
+		}
+		if version != 0 {
+			continue
+		}
+		if err := upgradeSegment(dir, id, i == len(ids)-1); err != nil {
+			return 0, fmt.Errorf("error upgrading segment %d: %w", id, err)
+		}
+		upgraded = id + 1
+	}
+
+	if upgraded > 0 {
+		if err := syncDir(dir); err != nil {
+			return 0, err
+		}
+	}
+	return upgraded, nil
+}
+
+// upgradeSegment 以目前的格式重新編碼版本 0 資料段中的每一筆 Entry。
+// 只有最後一個資料段可能留下寫到一半的尾端，會在升級時丟棄；其他資料段的損壞返回 *ErrCorrupt。
+func upgradeSegment(dir string, id uint32, last bool) (err error) {
+	path := segmentPath(dir, id)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + upgradeFileExt
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		out.Close()
+		if err != nil {
+			os.Remove(tmp)
+		}
+	}()
+
+	w := bufio.NewWriter(out)
+	if _, err := w.Write(encodeFileHeader(segmentMagic)); err != nil {
+		return err
+	}
+	for offset := int64(0); offset < int64(len(data)); {
+		entry, err := decodeEntryV0(data[offset:])
+		if err != nil {
+			// 第一筆 Entry 的 CRC 就不符時，檔案很可能不是版本 0 的資料段（例如檔頭損壞），不能當作尾端丟棄
+			if !last || (offset == 0 && errors.Is(err, ErrChecksum)) {
+				return &ErrCorrupt{Segment: id, Offset: offset, Err: err}
+			}
+			break
+		}
+		buf, err := entry.Encode()
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+		offset += entry.Size()
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+
+	// 提示檔記錄的是舊的偏移量，先刪除再替換資料段，之後改由完整掃描重建索引
+	if err := removeIfExists(hintPath(dir, id)); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// decodeEntryV0 解碼版本 0 的 Entry。
+// 標頭為 KeySize(4) + ValueSize(4) + Flags(1) + Mark(1) + KeyID(4) + CRC(4) + Timestamp(8) + ExpiresAt(8) + Seq(8)，
+// CRC 只涵蓋 key 與 value。
+func decodeEntryV0(buf []byte) (*Entry, error) {
+	if len(buf) < entryHeaderSize {
+		return nil, ErrTruncated
+	}
+
+	e := &Entry{
+		KeySize:   binary.BigEndian.Uint32(buf[0:4]),
+		ValueSize: binary.BigEndian.Uint32(buf[4:8]),
+		Flags:     EntryFlag(buf[8]),
+		Mark:      EntryType(buf[9]),
+		KeyID:     binary.BigEndian.Uint32(buf[10:14]),
+		CRC:       binary.BigEndian.Uint32(buf[14:18]),
+		Timestamp: int64(binary.BigEndian.Uint64(buf[18:26])),
+		ExpiresAt: int64(binary.BigEndian.Uint64(buf[26:34])),
+		Seq:       binary.BigEndian.Uint64(buf[34:42]),
+	}
+	ks, vs := int64(e.KeySize), int64(e.ValueSize)
+	if int64(len(buf)) < entryHeaderSize+ks+vs {
+		return nil, ErrTruncated
+	}
+
+	e.Key = buf[entryHeaderSize : entryHeaderSize+ks]
+	e.Value = buf[entryHeaderSize+ks : entryHeaderSize+ks+vs]
+	if crc32.ChecksumIEEE(buf[entryHeaderSize:entryHeaderSize+ks+vs]) != e.CRC {
+		return nil, ErrChecksum
+	}
+	return e, nil
+}
+
+// 舊版單檔資料庫 (bitcask.db) 的 Entry 標頭：KeySize(4) + ValueSize(4) + Mark(2) + CRC(4)，CRC 只涵蓋 key 與 value
+const legacyHeaderSize = 14
+
+// MigrateLegacyFile 將舊版的單檔資料庫 path 轉換為 dir 目錄下目前格式的資料庫，opts 用於開啟新的資料庫。
+// dir 不能已經含有資料段；檔案尾端寫到一半的 Entry 會被忽略，中間的損壞則返回錯誤。
+// 原本的檔案不會被修改，確認轉換結果後可自行刪除；轉換失敗時 dir 中可能留下部分資料，需要清空後重試。
+func MigrateLegacyFile(path, dir string, opts ...Option) (err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if ids, err := listSegmentIDs(dir); err == nil && len(ids) > 0 {
+		return fmt.Errorf("destination %s already contains data files", dir)
+	}
+
+	db, err := NewBitcask(dir, opts...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := db.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	for offset := 0; len(data)-offset >= legacyHeaderSize; {
+		ks := int(binary.BigEndian.Uint32(data[offset : offset+4]))
+		vs := int(binary.BigEndian.Uint32(data[offset+4 : offset+8]))
+		mark := EntryType(binary.BigEndian.Uint16(data[offset+8 : offset+10]))
+		if len(data)-offset-legacyHeaderSize < ks+vs {
+			break
+		}
+
+		key := data[offset+legacyHeaderSize : offset+legacyHeaderSize+ks]
+		value := data[offset+legacyHeaderSize+ks : offset+legacyHeaderSize+ks+vs]
+		crc := crc32.NewIEEE()
+		crc.Write(key)
+		crc.Write(value)
+		if crc.Sum32() != binary.BigEndian.Uint32(data[offset+10:offset+14]) {
+			return fmt.Errorf("%s is corrupted at offset %d: %w", path, offset, ErrChecksum)
+		}
+
+		switch mark {
+		case PUT:
+			err = db.Put(key, value)
+		case DEL:
+			if err = db.Delete(key); errors.Is(err, ErrKeyNotFound) {
+				err = nil
+			}
+		default:
+			err = fmt.Errorf("%s has unknown entry type %v at offset %d", path, mark, offset)
+		}
+		if err != nil {
+			return err
+		}
+		offset += legacyHeaderSize + ks + vs
+	}
+	return db.Sync()
+}
@@ -0,0 +1,161 @@
+package bitcask
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+)
+
+// 提示檔的副檔名，與對應的資料段同名，例如 000000001.hint
+const hintFileExt = ".hint"
+
+// 提示檔紀錄的固定長度部分：CRC(4) + Timestamp(8) + ExpiresAt(8) + KeySize(4) + Offset(8) + Size(8) + Flags(1) + KeyID(4) + Seq(8)
+const hintHeaderSize = 53
+
+// hintRecord 為提示檔中的一筆紀錄，只包含重建索引所需的資訊而不包含 value
+type hintRecord struct {
+	Key       []byte    // 與資料段中相同的 key，啟用加密時為加密後的內容
+	Offset    int64     // Entry 在資料段中的偏移量
+	Size      int64     // Entry 編碼後的總長度
+	Timestamp int64     // Entry 的寫入時間 (UnixNano)
+	ExpiresAt int64     // Entry 的過期時間 (UnixNano)，0 表示永不過期
+	Flags     EntryFlag // Entry 的 value 編碼方式
+	KeyID     uint32    // 加密 value 所用的金鑰編號
+	Seq       uint64    // Entry 的寫入序號
+}
+
+// hintPath 返回指定資料段的提示檔路徑
+func hintPath(dir string, id uint32) string {
+	return filepath.Join(dir, fmt.Sprintf("%09d%s", id, hintFileExt))
+}
+
+// encode 將提示紀錄編碼為字節數組，CRC 涵蓋 CRC 欄位之後的所有內容
+func (r *hintRecord) encode() []byte {
+	buf := make([]byte, hintHeaderSize+len(r.Key))
+	binary.BigEndian.PutUint64(buf[4:12], uint64(r.Timestamp))
+	binary.BigEndian.PutUint64(buf[12:20], uint64(r.ExpiresAt))
+	binary.BigEndian.PutUint32(buf[20:24], uint32(len(r.Key)))
+	binary.BigEndian.PutUint64(buf[24:32], uint64(r.Offset))
+	binary.BigEndian.PutUint64(buf[32:40], uint64(r.Size))
+	buf[40] = byte(r.Flags)
+	binary.BigEndian.PutUint32(buf[41:45], r.KeyID)
+	binary.BigEndian.PutUint64(buf[45:53], r.Seq)
+	copy(buf[hintHeaderSize:], r.Key)
+	binary.BigEndian.PutUint32(buf[0:4], crc32.ChecksumIEEE(buf[4:]))
+	return buf
+}
+
+// writeHintFile 將提示紀錄寫入 path 並同步到磁碟
+func writeHintFile(path string, records []hintRecord) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	if _, err := w.Write(encodeFileHeader(hintMagic)); err != nil {
+		return err
+	}
+	for i := range records {
+		if _, err := w.Write(records[i].encode()); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// readHintFile 讀取並校驗整個提示檔，檔頭的格式版本必須與目前相同。
+// limit 為對應資料段的大小，任何紀錄指向資料段以外的位置都視為提示檔損壞。
+func readHintFile(path string, limit int64) ([]hintRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := readFileVersion(bytes.NewReader(data), int64(len(data)), hintMagic)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFileVersion(path, version); err != nil {
+		return nil, err
+	}
+
+	var records []hintRecord
+	for pos := fileHeaderSize; pos < len(data); {
+		if len(data)-pos < hintHeaderSize {
+			return nil, errors.New("truncated hint record")
+		}
+		ks := int(binary.BigEndian.Uint32(data[pos+20 : pos+24]))
+		if len(data)-pos-hintHeaderSize < ks {
+			return nil, errors.New("truncated hint record")
+		}
+
+		buf := data[pos : pos+hintHeaderSize+ks]
+		if crc32.ChecksumIEEE(buf[4:]) != binary.BigEndian.Uint32(buf[0:4]) {
+			return nil, errors.New("hint record CRC mismatch")
+		}
+
+		r := hintRecord{
+			Key:       buf[hintHeaderSize:],
+			Timestamp: int64(binary.BigEndian.Uint64(buf[4:12])),
+			ExpiresAt: int64(binary.BigEndian.Uint64(buf[12:20])),
+			Offset:    int64(binary.BigEndian.Uint64(buf[24:32])),
+			Size:      int64(binary.BigEndian.Uint64(buf[32:40])),
+			Flags:     EntryFlag(buf[40]),
+			KeyID:     binary.BigEndian.Uint32(buf[41:45]),
+			Seq:       binary.BigEndian.Uint64(buf[45:53]),
+		}
+		if r.Offset < segmentHeaderSize || r.Size < entryHeaderSize+int64(ks) || r.Offset+r.Size > limit {
+			return nil, errors.New("hint record out of segment range")
+		}
+
+		records = append(records, r)
+		pos += len(buf)
+	}
+	return records, nil
+}
+
+// loadHint 嘗試以提示檔載入資料段的索引，提示檔不存在或損壞時返回 false
+func (bc *Bitcask) loadHint(seg *segment) bool {
+	records, err := readHintFile(hintPath(bc.dir, seg.id), seg.size)
+	if err != nil {
+		return false
+	}
+
+	// 先解密所有的 key，任何一筆失敗都退回完整掃描，不留下只載入一部分的索引
+	keys := make([][]byte, len(records))
+	for i, r := range records {
+		if keys[i], err = bc.codec.decodeKey(r.Flags, r.KeyID, r.Key); err != nil {
+			return false
+		}
+	}
+
+	now := bc.opts.now().UnixNano()
+	for i, r := range records {
+		bc.seq = max(bc.seq, r.Seq)
+		if isExpired(r.ExpiresAt, now) {
+			bc.keyDir.Delete(string(keys[i]))
+			continue
+		}
+		bc.keyDir.Put(string(keys[i]), KeyDirEntry{
+			FileID:    seg.id,
+			ValueSize: uint32(r.Size - entryHeaderSize - int64(len(r.Key))),
+			ValuePos:  r.Offset + entryHeaderSize + int64(len(r.Key)),
+			Timestamp: r.Timestamp,
+			ExpiresAt: r.ExpiresAt,
+			Flags:     r.Flags,
+			KeyID:     r.KeyID,
+			Seq:       r.Seq,
+		})
+	}
+	return true
+}
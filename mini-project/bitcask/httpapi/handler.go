@@ -0,0 +1,277 @@
+// httpapi 套件以 HTTP/JSON 對外提供 Bitcask 的存取：
+//
+//	GET    /kv/{key}       讀取 value，回應本體為原始位元組，ETag 為 Entry 的 CRC
+//	PUT    /kv/{key}       以請求本體寫入 value，可用 ?ttl=30s 設定存活時間
+//	DELETE /kv/{key}       刪除 key
+//	GET    /kv?prefix=P    以 JSON 列出以 P 開頭的 key
+//	POST   /batch          以 JSON 描述多個寫入與刪除，作為一個批次寫入
+//
+// GET 支援 If-None-Match；PUT 與 DELETE 支援 If-Match 與 If-None-Match: *，
+// 條件不成立時回應 412 Precondition Failed。
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Mahopanda/mini-project/bitcask"
+)
+
+// DefaultMaxBodySize 為請求本體預設的大小上限
+const DefaultMaxBodySize = 32 << 20
+
+// Handler 為 Bitcask 的 http.Handler，Handler 不負責關閉底層的 Bitcask
+type Handler struct {
+	db          *bitcask.Bitcask
+	mux         *http.ServeMux
+	maxBodySize int64
+}
+
+// Option 為 Handler 的設定選項
+type Option func(*Handler)
+
+// WithMaxBodySize 設定請求本體的大小上限，超過時回應 413
+func WithMaxBodySize(n int64) Option {
+	return func(h *Handler) {
+		h.maxBodySize = n
+	}
+}
+
+// NewHandler 建立以 db 為儲存的 Handler
+func NewHandler(db *bitcask.Bitcask, opts ...Option) *Handler {
+	h := &Handler{db: db, mux: http.NewServeMux(), maxBodySize: DefaultMaxBodySize}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	h.mux.HandleFunc("GET /kv/{key...}", h.get)
+	h.mux.HandleFunc("PUT /kv/{key...}", h.put)
+	h.mux.HandleFunc("DELETE /kv/{key...}", h.delete)
+	h.mux.HandleFunc("GET /kv", h.list)
+	h.mux.HandleFunc("POST /batch", h.batch)
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// BatchOp 為 POST /batch 中的一個操作
+type BatchOp struct {
+	Op    string `json:"op"` // "put" 或 "delete"
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	TTL   string `json:"ttl,omitempty"` // 例如 "30s"，只用於 put
+}
+
+// BatchRequest 為 POST /batch 的請求本體
+type BatchRequest struct {
+	Ops []BatchOp `json:"ops"`
+}
+
+// BatchResponse 為 POST /batch 成功時的回應本體
+type BatchResponse struct {
+	Applied int `json:"applied"`
+}
+
+// ListResponse 為 GET /kv 的回應本體
+type ListResponse struct {
+	Keys []string `json:"keys"`
+}
+
+// ErrorResponse 為所有錯誤回應的本體
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	value, crc, err := h.db.GetWithCRC([]byte(r.PathValue("key")))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	etag := formatETag(crc)
+	w.Header().Set("ETag", etag)
+	if matchETag(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", fmt.Sprint(len(value)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(value)
+	}
+}
+
+func (h *Handler) put(w http.ResponseWriter, r *http.Request) {
+	key := []byte(r.PathValue("key"))
+
+	var ttl time.Duration
+	if s := r.URL.Query().Get("ttl"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("invalid ttl %q", s)})
+			return
+		}
+		ttl = d
+	}
+
+	value, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBodySize))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	switch cond := preconditions(r); {
+	case cond != nil:
+		err = h.db.PutIfCRC(key, value, ttl, cond)
+	case ttl > 0:
+		err = h.db.PutWithTTL(key, value, ttl)
+	default:
+		err = h.db.Put(key, value)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	key := []byte(r.PathValue("key"))
+
+	var err error
+	if cond := preconditions(r); cond != nil {
+		err = h.db.DeleteIfCRC(key, cond)
+	} else {
+		err = h.db.Delete(key)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// preconditions 將 If-Match 與 If-None-Match 轉換為 Bitcask 的條件式寫入，沒有條件時返回 nil。
+// 條件由 Bitcask 在寫入鎖內判斷，檢查與寫入之間不會有其他來源的寫入插入。
+func preconditions(r *http.Request) bitcask.CRCCondition {
+	ifMatch := r.Header.Get("If-Match")
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifMatch == "" && ifNoneMatch == "" {
+		return nil
+	}
+
+	return func(crc uint32, exists bool) bool {
+		etag := ""
+		if exists {
+			etag = formatETag(crc)
+		}
+		if ifMatch != "" && (etag == "" || !matchETag(ifMatch, etag)) {
+			return false
+		}
+		return ifNoneMatch == "" || etag == "" || !matchETag(ifNoneMatch, etag)
+	}
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	keys := h.db.Scan([]byte(r.URL.Query().Get("prefix")))
+	if keys == nil {
+		keys = []string{}
+	}
+	writeJSON(w, http.StatusOK, ListResponse{Keys: keys})
+}
+
+func (h *Handler) batch(w http.ResponseWriter, r *http.Request) {
+	var req BatchRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("invalid batch: %v", err)})
+		return
+	}
+
+	wb := h.db.NewWriteBatch()
+	for i, op := range req.Ops {
+		switch op.Op {
+		case "put":
+			if op.TTL == "" {
+				wb.Put([]byte(op.Key), []byte(op.Value))
+				continue
+			}
+			ttl, err := time.ParseDuration(op.TTL)
+			if err == nil {
+				err = wb.PutWithTTL([]byte(op.Key), []byte(op.Value), ttl)
+			}
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("op %d: invalid ttl %q", i, op.TTL)})
+				return
+			}
+		case "delete":
+			wb.Delete([]byte(op.Key))
+		default:
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("op %d: unknown op %q", i, op.Op)})
+			return
+		}
+	}
+
+	if err := wb.Commit(); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, BatchResponse{Applied: len(req.Ops)})
+}
+
+// formatETag 將 CRC 格式化為強 ETag
+func formatETag(crc uint32) string {
+	return fmt.Sprintf(`"%08x"`, crc)
+}
+
+// matchETag 判斷 If-Match / If-None-Match 的標頭值是否包含 etag，* 匹配任何存在的值；
+// 比對時忽略弱 ETag 的 W/ 前綴
+func matchETag(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeError 將錯誤轉換為對應的狀態碼
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, bitcask.ErrKeyNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, bitcask.ErrConditionFailed):
+		status = http.StatusPreconditionFailed
+	case errors.Is(err, bitcask.ErrReadOnly):
+		status = http.StatusForbidden
+	case errors.Is(err, bitcask.ErrClosed):
+		status = http.StatusServiceUnavailable
+	case errors.As(err, &tooLarge):
+		status = http.StatusRequestEntityTooLarge
+	}
+	writeJSON(w, status, ErrorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,183 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mahopanda/mini-project/bitcask"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer 以暫存目錄中的資料庫啟動 HTTP 伺服器
+func newTestServer(t *testing.T, opts ...Option) (*bitcask.Bitcask, *httptest.Server) {
+	t.Helper()
+	db, err := bitcask.NewBitcask(t.TempDir(), bitcask.WithSweepInterval(0))
+	require.NoError(t, err)
+	srv := httptest.NewServer(NewHandler(db, opts...))
+	t.Cleanup(func() {
+		srv.Close()
+		db.Close()
+	})
+	return db, srv
+}
+
+// do 送出請求並返回狀態碼、回應標頭與本體
+func do(t *testing.T, method, url, body string, header ...string) (int, http.Header, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, resp.Header, string(data)
+}
+
+func TestKeyValue(t *testing.T) {
+	_, srv := newTestServer(t)
+
+	code, _, _ := do(t, http.MethodPut, srv.URL+"/kv/users/1", "alice")
+	assert.Equal(t, http.StatusNoContent, code)
+	code, _, _ = do(t, http.MethodPut, srv.URL+"/kv/users/2", "bob")
+	assert.Equal(t, http.StatusNoContent, code)
+	code, _, _ = do(t, http.MethodPut, srv.URL+"/kv/orders/1", "book")
+	assert.Equal(t, http.StatusNoContent, code)
+
+	code, header, body := do(t, http.MethodGet, srv.URL+"/kv/users/1", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "alice", body)
+	assert.Equal(t, "application/octet-stream", header.Get("Content-Type"))
+	assert.NotEmpty(t, header.Get("ETag"))
+
+	code, _, body = do(t, http.MethodGet, srv.URL+"/kv?prefix=users/", "")
+	assert.Equal(t, http.StatusOK, code)
+	var list ListResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &list))
+	assert.Equal(t, []string{"users/1", "users/2"}, list.Keys)
+
+	code, _, _ = do(t, http.MethodDelete, srv.URL+"/kv/users/2", "")
+	assert.Equal(t, http.StatusNoContent, code)
+	code, _, body = do(t, http.MethodGet, srv.URL+"/kv/users/2", "")
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Contains(t, body, `"error"`)
+	code, _, _ = do(t, http.MethodDelete, srv.URL+"/kv/users/2", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _, _ = do(t, http.MethodPut, srv.URL+"/kv/session?ttl=1h", "token")
+	assert.Equal(t, http.StatusNoContent, code)
+	code, _, body = do(t, http.MethodGet, srv.URL+"/kv/session", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "token", body)
+	code, _, _ = do(t, http.MethodPut, srv.URL+"/kv/session?ttl=10ms", "token")
+	assert.Equal(t, http.StatusNoContent, code)
+	assert.Eventually(t, func() bool {
+		code, _, _ := do(t, http.MethodGet, srv.URL+"/kv/session", "")
+		return code == http.StatusNotFound
+	}, 5*time.Second, 10*time.Millisecond)
+	code, _, _ = do(t, http.MethodPut, srv.URL+"/kv/session?ttl=abc", "token")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestConditionalRequests(t *testing.T) {
+	_, srv := newTestServer(t)
+	url := srv.URL + "/kv/counter"
+
+	// If-None-Match: * 只在 key 不存在時寫入
+	code, _, _ := do(t, http.MethodPut, url, "1", "If-None-Match", "*")
+	assert.Equal(t, http.StatusNoContent, code)
+	code, _, _ = do(t, http.MethodPut, url, "1", "If-None-Match", "*")
+	assert.Equal(t, http.StatusPreconditionFailed, code)
+
+	_, header, _ := do(t, http.MethodGet, url, "")
+	etag := header.Get("ETag")
+	code, _, body := do(t, http.MethodGet, url, "", "If-None-Match", etag)
+	assert.Equal(t, http.StatusNotModified, code)
+	assert.Empty(t, body)
+
+	// If-Match 只在 ETag 相符時寫入，寫入後 ETag 隨之改變
+	code, _, _ = do(t, http.MethodPut, url, "2", "If-Match", etag)
+	assert.Equal(t, http.StatusNoContent, code)
+	code, _, _ = do(t, http.MethodPut, url, "3", "If-Match", etag)
+	assert.Equal(t, http.StatusPreconditionFailed, code)
+
+	_, header, body = do(t, http.MethodGet, url, "", "If-None-Match", etag)
+	assert.Equal(t, "2", body)
+	assert.NotEqual(t, etag, header.Get("ETag"))
+
+	code, _, _ = do(t, http.MethodDelete, url, "", "If-Match", etag)
+	assert.Equal(t, http.StatusPreconditionFailed, code)
+	code, _, _ = do(t, http.MethodDelete, url, "", "If-Match", header.Get("ETag"))
+	assert.Equal(t, http.StatusNoContent, code)
+	code, _, _ = do(t, http.MethodPut, srv.URL+"/kv/missing", "v", "If-Match", "*")
+	assert.Equal(t, http.StatusPreconditionFailed, code)
+}
+
+func TestBatch(t *testing.T) {
+	db, srv := newTestServer(t)
+	require.NoError(t, db.Put([]byte("old"), []byte("v")))
+
+	code, _, body := do(t, http.MethodPost, srv.URL+"/batch",
+		`{"ops":[{"op":"put","key":"a","value":"1"},{"op":"put","key":"b","value":"2","ttl":"1h"},{"op":"delete","key":"old"}]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"applied":3}`, body)
+
+	value, err := db.Get([]byte("b"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("2"), value)
+	_, err = db.Get([]byte("old"))
+	assert.ErrorIs(t, err, bitcask.ErrKeyNotFound)
+
+	// 任何一個操作不合法時整個批次都不寫入
+	code, _, _ = do(t, http.MethodPost, srv.URL+"/batch",
+		`{"ops":[{"op":"put","key":"c","value":"3"},{"op":"rename","key":"a"}]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	_, err = db.Get([]byte("c"))
+	assert.ErrorIs(t, err, bitcask.ErrKeyNotFound)
+
+	code, _, _ = do(t, http.MethodPost, srv.URL+"/batch", `not json`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestEmptyKey(t *testing.T) {
+	db, srv := newTestServer(t)
+
+	// 與資料庫一致，/kv/ 與批次都接受空的 key
+	code, _, _ := do(t, http.MethodPut, srv.URL+"/kv/", "root")
+	assert.Equal(t, http.StatusNoContent, code)
+	code, _, body := do(t, http.MethodGet, srv.URL+"/kv/", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "root", body)
+
+	code, _, body = do(t, http.MethodPost, srv.URL+"/batch", `{"ops":[{"op":"put","key":"","value":"batched"}]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"applied":1}`, body)
+	value, err := db.Get([]byte(""))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("batched"), value)
+
+	code, _, _ = do(t, http.MethodPost, srv.URL+"/batch", `{"ops":[{"op":"delete","key":""}]}`)
+	assert.Equal(t, http.StatusOK, code)
+	code, _, _ = do(t, http.MethodGet, srv.URL+"/kv/", "")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _, _ = do(t, http.MethodDelete, srv.URL+"/kv/", "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestMaxBodySize(t *testing.T) {
+	_, srv := newTestServer(t, WithMaxBodySize(4))
+
+	code, _, _ := do(t, http.MethodPut, srv.URL+"/kv/k", "1234")
+	assert.Equal(t, http.StatusNoContent, code)
+	code, _, _ = do(t, http.MethodPut, srv.URL+"/kv/k", "12345")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+}
@@ -0,0 +1,111 @@
+package bitcask
+
+import "strings"
+
+// Scan 依字典序返回所有以 prefix 開頭且尚未過期的 key
+func (bc *Bitcask) Scan(prefix []byte) []string {
+	return bc.keyDir.Scan(string(prefix))
+}
+
+// Range 依字典序返回 [start, end) 之間尚未過期的 key，end 為空表示沒有上限
+func (bc *Bitcask) Range(start, end []byte) []string {
+	return bc.keyDir.Range(string(start), string(end))
+}
+
+// IteratorOptions 定義迭代器的走訪範圍與方向
+type IteratorOptions struct {
+	Prefix  []byte // 只走訪以 Prefix 開頭的 key
+	Reverse bool   // 為 true 時依字典序由大到小走訪
+}
+
+// iterSource 為迭代器的資料來源：Bitcask 讀取最新的狀態，Snapshot 讀取建立快照時的狀態
+type iterSource interface {
+	seek(from string, inclusive, bounded, reverse bool) (string, KeyDirEntry, bool)
+	Get(key []byte) ([]byte, error)
+}
+
+// Iterator 依字典序走訪尚未過期的 key。
+// 每次移動都重新從索引中查詢下一個 key，因此走訪期間不會阻擋寫入；
+// 由 Bitcask 建立時會看到走訪過程中新增或刪除的 key，由 Snapshot 建立時則不會。
+type Iterator struct {
+	src   iterSource
+	opts  IteratorOptions
+	key   string
+	valid bool
+}
+
+// NewIterator 建立迭代器並定位到第一個 key（Reverse 時為最後一個）
+func (bc *Bitcask) NewIterator(opts IteratorOptions) *Iterator {
+	return newIterator(bc, opts)
+}
+
+func newIterator(src iterSource, opts IteratorOptions) *Iterator {
+	it := &Iterator{src: src, opts: opts}
+	it.Rewind()
+	return it
+}
+
+// seek 在最新的索引中查詢迭代方向上的下一個 key
+func (bc *Bitcask) seek(from string, inclusive, bounded, reverse bool) (string, KeyDirEntry, bool) {
+	return bc.keyDir.seek(from, inclusive, bounded, reverse)
+}
+
+// Rewind 回到走訪方向上的第一個 key
+func (it *Iterator) Rewind() {
+	prefix := string(it.opts.Prefix)
+	if !it.opts.Reverse {
+		it.set(it.src.seek(prefix, true, true, false))
+		return
+	}
+
+	succ, bounded := prefixSuccessor(prefix)
+	it.set(it.src.seek(succ, false, bounded, true))
+}
+
+// Seek 定位到大於或等於 key 的第一個 key；Reverse 時則為小於或等於 key 的最後一個 key
+func (it *Iterator) Seek(key []byte) {
+	prefix := string(it.opts.Prefix)
+	from := string(key)
+	if !it.opts.Reverse {
+		if from < prefix {
+			from = prefix
+		}
+		it.set(it.src.seek(from, true, true, false))
+		return
+	}
+
+	if succ, ok := prefixSuccessor(prefix); ok && from >= succ {
+		it.set(it.src.seek(succ, false, true, true))
+		return
+	}
+	it.set(it.src.seek(from, true, true, true))
+}
+
+// Next 移動到走訪方向上的下一個 key
+func (it *Iterator) Next() {
+	if !it.valid {
+		return
+	}
+	it.set(it.src.seek(it.key, false, true, it.opts.Reverse))
+}
+
+// Valid 返回迭代器目前是否指向一個 key
+func (it *Iterator) Valid() bool {
+	return it.valid
+}
+
+// Key 返回目前的 key
+func (it *Iterator) Key() []byte {
+	return []byte(it.key)
+}
+
+// Value 讀取目前 key 的值
+func (it *Iterator) Value() ([]byte, error) {
+	return it.src.Get([]byte(it.key))
+}
+
+// set 更新迭代器位置，超出 Prefix 範圍時視為走訪結束
+func (it *Iterator) set(key string, _ KeyDirEntry, found bool) {
+	it.key = key
+	it.valid = found && strings.HasPrefix(key, string(it.opts.Prefix))
+}
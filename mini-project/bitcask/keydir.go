@@ -1,47 +1,258 @@
 package bitcask
 
-import "sync"
+import (
+	"strings"
+	"sync"
+	"time"
+)
 
+// KeyDirEntry 記錄 key 最新一筆資料的位置，與原始 Bitcask 設計相同，
+// 讀取時只需依 ValuePos 與 ValueSize 讀一次 value 本身
+type KeyDirEntry struct {
+	FileID    uint32    // 資料段編號
+	ValueSize uint32    // value 的長度
+	ValuePos  int64     // value 在資料段中的偏移量
+	Timestamp int64     // 寫入時間 (UnixNano)
+	ExpiresAt int64     // 過期時間 (UnixNano)，0 表示永不過期
+	Flags     EntryFlag // value 的編碼方式，讀取時據此解密與解壓縮
+	KeyID     uint32    // 加密 value 所用的金鑰編號
+	Seq       uint64    // 寫入序號，即 key 目前的版本號
+}
+
+// newKeyDirEntry 依 Entry 與其在資料段中的偏移量建立索引項目
+func newKeyDirEntry(fileID uint32, offset int64, e *Entry) KeyDirEntry {
+	return KeyDirEntry{
+		FileID:    fileID,
+		ValueSize: e.ValueSize,
+		ValuePos:  offset + entryHeaderSize + int64(e.KeySize),
+		Timestamp: e.Timestamp,
+		ExpiresAt: e.ExpiresAt,
+		Flags:     e.Flags,
+		KeyID:     e.KeyID,
+		Seq:       e.Seq,
+	}
+}
+
+// entryOffset 返回整筆 Entry 在資料段中的偏移量，keySize 為明文 key 的長度
+func (ke KeyDirEntry) entryOffset(keySize int) int64 {
+	return ke.ValuePos - diskKeySize(keySize, ke.Flags) - entryHeaderSize
+}
+
+// keyDirUpdate 為批次更新索引時的單一操作
+type keyDirUpdate struct {
+	key    string
+	entry  KeyDirEntry
+	delete bool
+}
+
+// KeyDir 以基數樹保存所有 key 的索引，key 依字典序排列，支援前綴與範圍查詢。
+// 基數樹採 copy-on-write，每次更新都換上一個新版本，讀取時只需在鎖內取得目前版本，
+// 之後的走訪不必持有鎖，取得的版本也可以直接作為快照保存。
 type KeyDir struct {
-	mu    sync.RWMutex
-	index map[string]int64
+	mu   sync.RWMutex
+	tree *radixTree
+	now  func() time.Time // 判斷 key 是否過期用的時鐘
 }
 
 // Key Directory 索引管理
 // NewKeyDir 初始化 KeyDir
 func NewKeyDir() *KeyDir {
-	return &KeyDir{index: make(map[string]int64)}
+	return newKeyDir(time.Now)
+}
+
+// newKeyDir 建立以 now 判斷過期的 KeyDir
+func newKeyDir(now func() time.Time) *KeyDir {
+	return &KeyDir{tree: newRadixTree(), now: now}
 }
 
-// Get 返回 key 對應的文件偏移量
-func (kd *KeyDir) Get(key string) (int64, bool) {
+// snapshot 返回目前版本的索引，之後的更新不會影響返回的版本
+func (kd *KeyDir) snapshot() *radixTree {
 	kd.mu.RLock()
 	defer kd.mu.RUnlock()
-	offset, ok := kd.index[key]
-	return offset, ok
+	return kd.tree
+}
+
+// Get 返回 key 對應的索引資料，已過期的 key 視為不存在
+func (kd *KeyDir) Get(key string) (KeyDirEntry, bool) {
+	return kd.snapshot().lookup(key, kd.now().UnixNano())
+}
+
+// Put 更新 key 的位置
+func (kd *KeyDir) Put(key string, entry KeyDirEntry) {
+	kd.mu.Lock()
+	defer kd.mu.Unlock()
+	kd.tree = kd.tree.insert(key, entry)
+}
+
+// CompareAndPut 僅在 key 目前的位置仍為 old 時才更新為 entry，返回是否更新成功
+func (kd *KeyDir) CompareAndPut(key string, old, entry KeyDirEntry) bool {
+	kd.mu.Lock()
+	defer kd.mu.Unlock()
+	if cur, ok := kd.tree.get(key); !ok || cur != old {
+		return false
+	}
+	kd.tree = kd.tree.insert(key, entry)
+	return true
 }
 
-// Put 更新 key 的偏移量
-func (kd *KeyDir) Put(key string, offset int64) {
+// Apply 套用多個更新後才換上新版本，讀取者不會看到只套用一半的狀態
+func (kd *KeyDir) Apply(updates []keyDirUpdate) {
 	kd.mu.Lock()
 	defer kd.mu.Unlock()
-	kd.index[key] = offset
+	tree := kd.tree
+	for _, u := range updates {
+		if u.delete {
+			tree, _ = tree.delete(u.key)
+		} else {
+			tree = tree.insert(u.key, u.entry)
+		}
+	}
+	kd.tree = tree
 }
 
 // Delete 從索引中刪除 key
 func (kd *KeyDir) Delete(key string) {
 	kd.mu.Lock()
 	defer kd.mu.Unlock()
-	delete(kd.index, key)
+	kd.tree, _ = kd.tree.delete(key)
+}
+
+// Len 返回索引中的 key 數量（包含尚未被清除的過期 key）
+func (kd *KeyDir) Len() int {
+	return kd.snapshot().size
 }
 
-// ListKeys 返回所有 key
+// ListKeys 依字典序返回所有尚未過期的 key
 func (kd *KeyDir) ListKeys() []string {
-	kd.mu.RLock()
-	defer kd.mu.RUnlock()
-	keys := make([]string, 0, len(kd.index))
-	for key := range kd.index {
-		keys = append(keys, key)
+	return kd.Range("", "")
+}
+
+// Scan 依字典序返回所有以 prefix 開頭且尚未過期的 key
+func (kd *KeyDir) Scan(prefix string) []string {
+	return kd.snapshot().scanKeys(prefix, kd.now().UnixNano())
+}
+
+// Range 依字典序返回 [start, end) 之間尚未過期的 key，end 為空字串表示沒有上限
+func (kd *KeyDir) Range(start, end string) []string {
+	return kd.snapshot().rangeKeys(start, end, kd.now().UnixNano())
+}
+
+// Ascend 依字典序走訪大於或等於 from 且尚未過期的 key，fn 返回 false 時停止。
+// 走訪的是呼叫當下的版本，fn 中可以修改 KeyDir，但修改不會出現在這次走訪中。
+func (kd *KeyDir) Ascend(from string, fn func(key string, entry KeyDirEntry) bool) {
+	kd.snapshot().ascendLive(from, kd.now().UnixNano(), fn)
+}
+
+// seek 返回迭代方向上緊接在 from 之後（inclusive 時包含 from）第一個尚未過期的 key
+func (kd *KeyDir) seek(from string, inclusive, bounded, reverse bool) (string, KeyDirEntry, bool) {
+	return kd.snapshot().seek(from, inclusive, bounded, reverse, kd.now().UnixNano())
+}
+
+// RemoveExpired 從索引中移除在 now (UnixNano) 時已過期的 key，返回移除的數量。
+// 走訪不持有鎖，只在最後移除時短暫持有寫入鎖，走訪期間被重新寫入的 key 不會被移除。
+func (kd *KeyDir) RemoveExpired(now int64) int {
+	var expired []keyDirUpdate
+	kd.snapshot().ascend("", true, func(key string, entry KeyDirEntry) bool {
+		if isExpired(entry.ExpiresAt, now) {
+			expired = append(expired, keyDirUpdate{key: key, entry: entry, delete: true})
+		}
+		return true
+	})
+	if len(expired) == 0 {
+		return 0
+	}
+	return kd.compareAndDelete(expired)
+}
+
+// compareAndDelete 刪除位置仍與 items 中記錄的相同的 key，返回刪除的數量
+func (kd *KeyDir) compareAndDelete(items []keyDirUpdate) int {
+	kd.mu.Lock()
+	defer kd.mu.Unlock()
+	removed := 0
+	for _, item := range items {
+		if cur, ok := kd.tree.get(item.key); ok && cur == item.entry {
+			kd.tree, _ = kd.tree.delete(item.key)
+			removed++
+		}
 	}
+	return removed
+}
+
+// ForEach 依字典序對每個 key（包含尚未被清除的過期 key）呼叫 fn，fn 返回 false 時停止走訪
+func (kd *KeyDir) ForEach(fn func(key string, entry KeyDirEntry) bool) {
+	kd.snapshot().ascend("", true, fn)
+}
+
+// 以下查詢以 now (UnixNano) 判斷過期，KeyDir 傳入目前時間，快照則固定使用建立時的時間
+
+// lookup 返回 key 對應的索引資料，在 now 時已過期的 key 視為不存在
+func (t *radixTree) lookup(key string, now int64) (KeyDirEntry, bool) {
+	entry, ok := t.get(key)
+	if !ok || isExpired(entry.ExpiresAt, now) {
+		return KeyDirEntry{}, false
+	}
+	return entry, true
+}
+
+// scanKeys 依字典序返回所有以 prefix 開頭且尚未過期的 key
+func (t *radixTree) scanKeys(prefix string, now int64) []string {
+	var keys []string
+	t.ascendLive(prefix, now, func(key string, _ KeyDirEntry) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return false
+		}
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// rangeKeys 依字典序返回 [start, end) 之間尚未過期的 key，end 為空字串表示沒有上限
+func (t *radixTree) rangeKeys(start, end string, now int64) []string {
+	var keys []string
+	t.ascendLive(start, now, func(key string, _ KeyDirEntry) bool {
+		if end != "" && key >= end {
+			return false
+		}
+		keys = append(keys, key)
+		return true
+	})
 	return keys
 }
+
+// ascendLive 依字典序走訪大於或等於 from 且尚未過期的 key
+func (t *radixTree) ascendLive(from string, now int64, fn func(key string, entry KeyDirEntry) bool) {
+	t.ascend(from, true, func(key string, entry KeyDirEntry) bool {
+		if isExpired(entry.ExpiresAt, now) {
+			return true
+		}
+		return fn(key, entry)
+	})
+}
+
+// seek 返回迭代方向上緊接在 from 之後（inclusive 時包含 from）第一個尚未過期的 key。
+// reverse 為 false 時往字典序較大的方向，否則往較小的方向；bounded 為 false 時從頭或尾開始。
+func (t *radixTree) seek(from string, inclusive, bounded, reverse bool, now int64) (string, KeyDirEntry, bool) {
+	var (
+		found bool
+		key   string
+		entry KeyDirEntry
+	)
+	visit := func(k string, e KeyDirEntry) bool {
+		if isExpired(e.ExpiresAt, now) {
+			return true
+		}
+		found, key, entry = true, k, e
+		return false
+	}
+
+	if reverse {
+		t.descend(from, inclusive, bounded, visit)
+	} else {
+		if !bounded {
+			from, inclusive = "", true
+		}
+		t.ascend(from, inclusive, visit)
+	}
+	return key, entry, found
+}
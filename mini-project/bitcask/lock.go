@@ -0,0 +1,68 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// 資料目錄中的鎖檔名稱
+const lockFileName = "LOCK"
+
+var (
+	// ErrLocked 表示資料目錄已被另一個程序以不相容的模式開啟
+	ErrLocked = errors.New("bitcask directory is locked by another process")
+	// ErrReadOnly 表示資料庫以唯讀模式開啟，不允許寫入
+	ErrReadOnly = errors.New("bitcask is opened read-only")
+)
+
+// LockError 描述取得資料目錄鎖失敗的原因，可用 errors.Is(err, ErrLocked) 判斷是否被其他程序佔用
+type LockError struct {
+	Path   string // 鎖檔路徑
+	Shared bool   // 是否為唯讀模式要求的共享鎖
+	Err    error
+}
+
+func (e *LockError) Error() string {
+	mode := "exclusive"
+	if e.Shared {
+		mode = "shared"
+	}
+	return fmt.Sprintf("cannot acquire %s lock on %s: %v", mode, e.Path, e.Err)
+}
+
+func (e *LockError) Unwrap() error {
+	return e.Err
+}
+
+// dirLock 為資料目錄上的建議性檔案鎖 (advisory lock)。
+// 寫入模式取得獨佔鎖，唯讀模式取得共享鎖，因此多個唯讀程序可以同時開啟，
+// 但只要有一個程序在寫入，其他程序都無法開啟。
+type dirLock struct {
+	file *os.File
+}
+
+// acquireDirLock 以非阻塞的方式鎖定 dir，已被其他程序鎖定時返回包裝 ErrLocked 的 *LockError
+func acquireDirLock(dir string, shared bool) (*dirLock, error) {
+	path := filepath.Join(dir, lockFileName)
+	file, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, &LockError{Path: path, Shared: shared, Err: err}
+	}
+
+	if err := lockFile(file, shared); err != nil {
+		file.Close()
+		return nil, &LockError{Path: path, Shared: shared, Err: err}
+	}
+	return &dirLock{file: file}, nil
+}
+
+// release 解除鎖定並關閉鎖檔，鎖檔本身保留在目錄中
+func (l *dirLock) release() error {
+	if l == nil {
+		return nil
+	}
+	unlockFile(l.file)
+	return l.file.Close()
+}
@@ -0,0 +1,20 @@
+//go:build !unix && !windows
+
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// lockFile 在沒有檔案鎖的平台上返回錯誤，避免多個程序在不知情的情況下同時寫入同一個目錄
+func lockFile(file *os.File, shared bool) error {
+	return fmt.Errorf("file locking is not supported on %s: %w", runtime.GOOS, errors.ErrUnsupported)
+}
+
+// unlockFile 在沒有檔案鎖的平台上不做任何事
+func unlockFile(file *os.File) error {
+	return nil
+}
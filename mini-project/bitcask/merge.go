@@ -0,0 +1,345 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	mergeDirName      = "merge"          // 合併過程中輸出檔案的暫存目錄
+	mergeFinishedName = "MERGE_FINISHED" // 合併輸出已完整寫入的標記檔
+)
+
+var (
+	// ErrMergeInProgress 表示已有另一個合併正在進行
+	ErrMergeInProgress = errors.New("merge is already in progress")
+	// ErrMergePending 表示上次合併的檔案替換沒有完成，重新開啟資料庫時會完成替換，在此之前無法再合併
+	ErrMergePending = errors.New("merge install is pending, reopen the database to finish it")
+)
+
+// mergeItem 記錄一個要被搬移到合併檔案中的 key
+type mergeItem struct {
+	key string
+	pos KeyDirEntry
+}
+
+// Merge 將所有封存資料段中仍然有效的資料重寫到新的合併檔案，並取代原本的資料段，
+// 重寫時 value 會轉換為目前的壓縮與加密設定，舊金鑰加密的資料也會改用目前的金鑰。
+// 合併期間只在切換資料段與最後替換檔案時短暫持有鎖，讀寫操作可以繼續進行。
+// 封存的資料段不會再被寫入，合併持有每個輸入資料段的參考，期間即使資料庫被關閉也不會關閉檔案，
+// 因此可以不持有鎖直接以 ReadAt 讀取。
+// 資料庫關閉時進行中的合併會中止並捨棄輸出，關閉之後呼叫返回 ErrClosed。
+func (bc *Bitcask) Merge() error {
+	if !bc.mergeMu.TryLock() {
+		bc.mu.RLock()
+		closed := bc.closed
+		bc.mu.RUnlock()
+		if closed {
+			return ErrClosed
+		}
+		return ErrMergeInProgress
+	}
+	defer bc.mergeMu.Unlock()
+
+	// 1. 封存活躍資料段，之後所有編號小於 boundary 的資料段都不會再被寫入
+	bc.writeMu.Lock()
+	if err := bc.checkWritable(); err != nil {
+		bc.writeMu.Unlock()
+		return err
+	}
+	if !bc.active.empty() {
+		if err := bc.rotate(); err != nil {
+			bc.writeMu.Unlock()
+			return err
+		}
+	}
+	boundary := bc.active.id
+	inputs := make(map[uint32]*segment, len(bc.segments))
+	ids := make([]uint32, 0, len(bc.segments))
+	for id, seg := range bc.segments {
+		seg.acquire()
+		inputs[id] = seg
+		ids = append(ids, id)
+	}
+	bc.writeMu.Unlock()
+	defer func() {
+		for _, seg := range inputs {
+			seg.release()
+		}
+	}()
+
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	// 2. 收集仍指向封存資料段且尚未過期的 key，依檔案位置排序以便循序讀取
+	var items []mergeItem
+	now := bc.opts.now().UnixNano()
+	bc.keyDir.ForEach(func(key string, pos KeyDirEntry) bool {
+		if pos.FileID < boundary && !isExpired(pos.ExpiresAt, now) {
+			items = append(items, mergeItem{key: key, pos: pos})
+		}
+		return true
+	})
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].pos.FileID != items[j].pos.FileID {
+			return items[i].pos.FileID < items[j].pos.FileID
+		}
+		return items[i].pos.ValuePos < items[j].pos.ValuePos
+	})
+
+	// 3. 將有效資料寫入暫存目錄中的合併檔案。
+	// 上次的替換中途失敗時，舊資料段可能已被刪除，合併目錄是唯一的副本，不能直接捨棄
+	mergeDir := filepath.Join(bc.dir, mergeDirName)
+	if _, _, err := readMergeFinished(mergeDir); err == nil {
+		return ErrMergePending
+	}
+	if err := os.RemoveAll(mergeDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(mergeDir, 0755); err != nil {
+		return err
+	}
+
+	outputs, moved, err := bc.writeMergeFiles(mergeDir, ids, inputs, items)
+	if err != nil {
+		os.RemoveAll(mergeDir)
+		return err
+	}
+
+	if err := writeMergeFinished(mergeDir, boundary, outputs); err != nil {
+		os.RemoveAll(mergeDir)
+		return err
+	}
+
+	// 4. 持有鎖替換資料段並更新索引；仍被快照引用的舊資料段會在快照釋放後才關閉。
+	// 先完成檔案替換並開啟所有輸出資料段，之後才移除舊的資料段；
+	// 中途失敗時索引與資料段集合維持原狀，已開啟的舊檔案仍可讀取，重新開啟時再由 recoverMerge 完成替換。
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if bc.closed {
+		os.RemoveAll(mergeDir)
+		return ErrClosed
+	}
+
+	if err := installMerge(bc.dir, boundary, outputs); err != nil {
+		return fmt.Errorf("%w: %v", ErrMergePending, err)
+	}
+
+	opened := make(map[uint32]*segment, len(outputs))
+	for _, id := range outputs {
+		seg, err := openSegment(bc.dir, id)
+		if err != nil {
+			for _, seg := range opened {
+				seg.Close()
+			}
+			return err
+		}
+		opened[id] = seg
+	}
+
+	for _, id := range ids {
+		bc.segments[id].release()
+		delete(bc.segments, id)
+	}
+	for id, seg := range opened {
+		bc.segments[id] = seg
+	}
+
+	for i, item := range items {
+		bc.keyDir.CompareAndPut(item.key, item.pos, moved[i])
+	}
+	bc.lastMerge = time.Now()
+	bc.compacted = boundary
+	return nil
+}
+
+// writeMergeFiles 依序讀出 items 並寫入合併檔案，每個合併檔案旁另外寫一份提示檔，
+// 返回輸出的資料段編號與每個 key 的新位置。
+// 合併檔案沿用輸入資料段中最小的幾個編號，因此輸出的資料段數量不會超過輸入。
+func (bc *Bitcask) writeMergeFiles(mergeDir string, ids []uint32, inputs map[uint32]*segment, items []mergeItem) ([]uint32, []KeyDirEntry, error) {
+	moved := make([]KeyDirEntry, len(items))
+	outputs := []uint32{ids[0]}
+
+	out, err := openSegment(mergeDir, ids[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { out.Close() }()
+
+	var hints []hintRecord
+	finish := func() error {
+		if err := out.file.Sync(); err != nil {
+			return err
+		}
+		return writeHintFile(hintPath(mergeDir, out.id), hints)
+	}
+
+	for i, item := range items {
+		select {
+		case <-bc.stopCh:
+			return nil, nil, ErrClosed
+		default:
+		}
+
+		input := inputs[item.pos.FileID]
+		entry, err := input.readEntry(item.pos.entryOffset(len(item.key)), input.size)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading key %q: %w", item.key, err)
+		}
+		if entry, err = bc.codec.transcode(entry); err != nil {
+			return nil, nil, err
+		}
+
+		data, err := entry.Encode()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if !out.empty() && out.size+int64(len(data)) > bc.opts.MaxFileSize && len(outputs) < len(ids) {
+			if err := finish(); err != nil {
+				return nil, nil, err
+			}
+			out.Close()
+			hints = hints[:0]
+
+			next, err := openSegment(mergeDir, ids[len(outputs)])
+			if err != nil {
+				return nil, nil, err
+			}
+			out = next
+			outputs = append(outputs, next.id)
+		}
+
+		if _, err := out.file.WriteAt(data, out.size); err != nil {
+			return nil, nil, err
+		}
+		moved[i] = newKeyDirEntry(out.id, out.size, entry)
+		hints = append(hints, hintRecord{
+			Key:       entry.Key,
+			Offset:    out.size,
+			Size:      int64(len(data)),
+			Timestamp: entry.Timestamp,
+			ExpiresAt: entry.ExpiresAt,
+			Flags:     entry.Flags,
+			KeyID:     entry.KeyID,
+			Seq:       entry.Seq,
+		})
+		out.size += int64(len(data))
+	}
+
+	if err := finish(); err != nil {
+		return nil, nil, err
+	}
+	return outputs, moved, nil
+}
+
+// writeMergeFinished 寫入合併完成的標記檔，內容為 boundary 與所有輸出的資料段編號
+func writeMergeFinished(mergeDir string, boundary uint32, outputs []uint32) error {
+	fields := []string{strconv.FormatUint(uint64(boundary), 10)}
+	for _, id := range outputs {
+		fields = append(fields, strconv.FormatUint(uint64(id), 10))
+	}
+
+	file, err := os.Create(filepath.Join(mergeDir, mergeFinishedName))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(strings.Join(fields, " ")); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// readMergeFinished 讀取合併完成的標記檔
+func readMergeFinished(mergeDir string) (uint32, []uint32, error) {
+	data, err := os.ReadFile(filepath.Join(mergeDir, mergeFinishedName))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, nil, fmt.Errorf("empty merge marker")
+	}
+
+	var ids []uint32
+	for _, f := range fields {
+		id, err := strconv.ParseUint(f, 10, 32)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid merge marker: %v", err)
+		}
+		ids = append(ids, uint32(id))
+	}
+	return ids[0], ids[1:], nil
+}
+
+// installMerge 刪除被合併的舊資料段與提示檔，並把合併檔案搬入資料目錄。
+// 此操作可重複執行，啟動時用來完成上次因當機而中斷的替換。
+func installMerge(dir string, boundary uint32, outputs []uint32) error {
+	mergeDir := filepath.Join(dir, mergeDirName)
+
+	isOutput := make(map[uint32]bool, len(outputs))
+	for _, id := range outputs {
+		isOutput[id] = true
+	}
+
+	ids, err := listSegmentIDs(dir)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if id < boundary && !isOutput[id] {
+			if err := removeIfExists(hintPath(dir, id)); err != nil {
+				return err
+			}
+			if err := os.Remove(segmentPath(dir, id)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, id := range outputs {
+		// 舊的提示檔必須先於資料段移除，避免留下與新資料段不符的提示檔
+		if src := segmentPath(mergeDir, id); fileExists(src) {
+			if err := removeIfExists(hintPath(dir, id)); err != nil {
+				return err
+			}
+			if err := moveFile(src, segmentPath(dir, id)); err != nil {
+				return err
+			}
+		}
+		if src := hintPath(mergeDir, id); fileExists(src) {
+			if err := moveFile(src, hintPath(dir, id)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return os.RemoveAll(mergeDir)
+}
+
+// recoverMerge 在開啟資料庫前處理上次遺留的合併目錄：
+// 有完成標記就繼續完成替換，否則代表合併未完成，直接捨棄
+func recoverMerge(dir string) error {
+	mergeDir := filepath.Join(dir, mergeDirName)
+	if _, err := os.Stat(mergeDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	boundary, outputs, err := readMergeFinished(mergeDir)
+	if err != nil {
+		return os.RemoveAll(mergeDir)
+	}
+	return installMerge(dir, boundary, outputs)
+}
@@ -0,0 +1,170 @@
+package bitcask
+
+import "time"
+
+const (
+	// DefaultMaxFileSize 為資料段預設的大小上限 (64MB)
+	DefaultMaxFileSize int64 = 64 << 20
+	// DefaultSweepInterval 為背景清除過期 key 的預設間隔
+	DefaultSweepInterval = time.Minute
+)
+
+// SyncPolicy 決定寫入後何時呼叫 fsync 將資料落盤
+type SyncPolicy int
+
+const (
+	SyncNever    SyncPolicy = iota // 不主動 fsync，交由作業系統決定，延遲最低
+	SyncAlways                     // 每次寫入後立即 fsync，最安全但延遲最高
+	SyncInterval                   // 背景定時 fsync
+	SyncBytes                      // 累積寫入超過指定位元組數後 fsync
+)
+
+// Options 定義 Bitcask 的可調整參數
+type Options struct {
+	MaxFileSize   int64         // 活躍資料段達到此大小後即切換到新的資料段
+	SweepInterval time.Duration // 背景清除過期 key 的間隔，0 表示不啟用
+	SyncPolicy    SyncPolicy    // 寫入的落盤策略
+	SyncInterval  time.Duration // SyncInterval 策略下的 fsync 間隔
+	SyncBytes     int64         // SyncBytes 策略下觸發 fsync 的累積位元組數
+	// VerifyChecksum 為 true 時 Get 每次都讀出整筆 Entry 校驗 CRC，
+	// 否則只讀 value 本身，需要時可改用 GetVerified 按需校驗
+	VerifyChecksum bool
+	// ReadOnly 為 true 時以共享鎖唯讀開啟，多個唯讀程序可同時開啟同一個目錄，
+	// 所有寫入與合併都會返回 ErrReadOnly
+	ReadOnly bool
+	// Compression 為寫入時 value 的壓縮方式，只影響新寫入與合併時重寫的資料，
+	// 讀取時依每筆 Entry 的旗標解壓縮，因此可以隨時變更
+	Compression Compression
+	// EncryptionKey 不為 nil 時，所有新寫入的 value 都以此 AES 金鑰 (16、24 或 32 位元組) 加密，
+	// 並在 Entry 標頭記錄 EncryptionKeyID；合併時舊金鑰加密的資料會改用此金鑰重新加密
+	EncryptionKey   []byte
+	EncryptionKeyID uint32
+	// DecryptionKeys 為輪替金鑰時仍需讀取的舊金鑰，依金鑰編號查詢，只用於解密
+	DecryptionKeys map[uint32][]byte
+	// AutoMerge 不為 nil 時由背景工作依此策略自動合併，唯讀模式下不啟用
+	AutoMerge *MergePolicy
+
+	now func() time.Time // 計算與判斷過期時間用的時鐘，測試時可替換
+}
+
+// Option 以函數選項的方式修改 Options
+type Option func(*Options)
+
+// defaultOptions 返回預設的參數
+func defaultOptions() Options {
+	return Options{
+		MaxFileSize:   DefaultMaxFileSize,
+		SweepInterval: DefaultSweepInterval,
+		now:           time.Now,
+	}
+}
+
+// withClock 以 now 取代計算與判斷過期時間時使用的時鐘
+func withClock(now func() time.Time) Option {
+	return func(o *Options) {
+		o.now = now
+	}
+}
+
+// WithMaxFileSize 設定單一資料段的大小上限
+func WithMaxFileSize(size int64) Option {
+	return func(o *Options) {
+		if size > 0 {
+			o.MaxFileSize = size
+		}
+	}
+}
+
+// WithSweepInterval 設定背景清除過期 key 的間隔，傳入 0 可關閉背景清除
+func WithSweepInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		if interval >= 0 {
+			o.SweepInterval = interval
+		}
+	}
+}
+
+// WithSyncAlways 每次寫入後都呼叫 fsync
+func WithSyncAlways() Option {
+	return func(o *Options) {
+		o.SyncPolicy = SyncAlways
+	}
+}
+
+// WithSyncInterval 由背景工作每隔 interval 呼叫一次 fsync
+func WithSyncInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		if interval > 0 {
+			o.SyncPolicy = SyncInterval
+			o.SyncInterval = interval
+		}
+	}
+}
+
+// WithSyncBytes 在累積寫入 n 個位元組後呼叫 fsync
+func WithSyncBytes(n int64) Option {
+	return func(o *Options) {
+		if n > 0 {
+			o.SyncPolicy = SyncBytes
+			o.SyncBytes = n
+		}
+	}
+}
+
+// WithSyncNever 不主動呼叫 fsync（預設值），仍可透過 Sync 或 Close 手動落盤
+func WithSyncNever() Option {
+	return func(o *Options) {
+		o.SyncPolicy = SyncNever
+	}
+}
+
+// WithVerifyChecksum 設定 Get 是否每次都校驗 CRC
+func WithVerifyChecksum(verify bool) Option {
+	return func(o *Options) {
+		o.VerifyChecksum = verify
+	}
+}
+
+// WithReadOnly 以唯讀模式開啟資料庫，不會截斷、合併或寫入任何資料
+func WithReadOnly() Option {
+	return func(o *Options) {
+		o.ReadOnly = true
+	}
+}
+
+// WithCompression 設定寫入時 value 的壓縮方式，合併時也會將舊資料轉換為此設定
+func WithCompression(c Compression) Option {
+	return func(o *Options) {
+		o.Compression = c
+	}
+}
+
+// WithEncryption 以 AES-GCM 加密所有新寫入的 key 與 value，keyID 記錄在每筆 Entry 的標頭中。
+// 資料段與提示檔中都只保存加密後的 key，開啟時需要所有用過的金鑰才能解密 key 重建索引，
+// 缺少金鑰時返回包裝 ErrAuthentication 的錯誤；舊版只加密 value 的 Entry 會在合併時一併加密 key。
+func WithEncryption(key []byte, keyID uint32) Option {
+	return func(o *Options) {
+		o.EncryptionKey = key
+		o.EncryptionKeyID = keyID
+	}
+}
+
+// WithDecryptionKey 加入一把只用來解密的舊金鑰，輪替金鑰後可透過合併將資料改用新金鑰加密
+func WithDecryptionKey(key []byte, keyID uint32) Option {
+	return func(o *Options) {
+		if o.DecryptionKeys == nil {
+			o.DecryptionKeys = make(map[uint32][]byte)
+		}
+		o.DecryptionKeys[keyID] = key
+	}
+}
+
+// WithAutoMerge 啟用背景自動合併，依 policy 的門檻與時段決定何時執行 Merge
+func WithAutoMerge(policy MergePolicy) Option {
+	return func(o *Options) {
+		if policy.Interval <= 0 {
+			policy.Interval = DefaultMergeCheckInterval
+		}
+		o.AutoMerge = &policy
+	}
+}
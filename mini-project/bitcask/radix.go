@@ -0,0 +1,233 @@
+package bitcask
+
+import (
+	"sort"
+	"strings"
+)
+
+// radixNode 為基數樹 (radix tree) 的節點，每條邊以一段共同前綴標記，
+// 子節點依前綴的第一個字元排序，因此依序走訪即為 key 的字典序。
+// 節點建立後就不再修改，更新時複製從根到目標節點的路徑 (copy-on-write)，
+// 舊的根節點因此仍是一份完整且不變的索引，可直接作為快照使用。
+type radixNode struct {
+	prefix   string       // 從父節點到此節點的邊標籤
+	children []*radixNode // 依 prefix 第一個字元排序的子節點
+	leaf     bool         // 此節點本身是否對應一個 key
+	entry    KeyDirEntry  // leaf 為 true 時 key 的索引資料
+}
+
+// radixTree 為某一版本的索引，支援前綴與範圍走訪；insert 與 delete 都返回新版本，
+// 原本的版本維持不變，可在不加鎖的情況下被並行讀取
+type radixTree struct {
+	root *radixNode
+	size int
+}
+
+func newRadixTree() *radixTree {
+	return &radixTree{root: &radixNode{}}
+}
+
+// findChild 返回第一個字元為 c 的子節點及其位置，不存在時返回可插入的位置
+func (n *radixNode) findChild(c byte) (int, *radixNode) {
+	idx := sort.Search(len(n.children), func(i int) bool {
+		return n.children[i].prefix[0] >= c
+	})
+	if idx < len(n.children) && n.children[idx].prefix[0] == c {
+		return idx, n.children[idx]
+	}
+	return idx, nil
+}
+
+// clone 複製節點本身與子節點切片，子節點則與原節點共用
+func (n *radixNode) clone() *radixNode {
+	c := *n
+	c.children = append([]*radixNode(nil), n.children...)
+	return &c
+}
+
+// get 查詢 key 的索引資料
+func (t *radixTree) get(key string) (KeyDirEntry, bool) {
+	n := t.root
+	search := key
+	for search != "" {
+		_, child := n.findChild(search[0])
+		if child == nil || !strings.HasPrefix(search, child.prefix) {
+			return KeyDirEntry{}, false
+		}
+		n = child
+		search = search[len(child.prefix):]
+	}
+	return n.entry, n.leaf
+}
+
+// insert 返回新增或更新 key 之後的新版本
+func (t *radixTree) insert(key string, entry KeyDirEntry) *radixTree {
+	root, added := t.root.insert(key, entry)
+	size := t.size
+	if added {
+		size++
+	}
+	return &radixTree{root: root, size: size}
+}
+
+// insert 返回插入後的節點副本，以及 key 是否為新增
+func (n *radixNode) insert(search string, entry KeyDirEntry) (*radixNode, bool) {
+	c := n.clone()
+	if search == "" {
+		added := !c.leaf
+		c.leaf = true
+		c.entry = entry
+		return c, added
+	}
+
+	idx, child := n.findChild(search[0])
+	if child == nil {
+		leaf := &radixNode{prefix: search, leaf: true, entry: entry}
+		c.children = append(c.children, nil)
+		copy(c.children[idx+1:], c.children[idx:])
+		c.children[idx] = leaf
+		return c, true
+	}
+
+	common := commonPrefixLen(search, child.prefix)
+	if common == len(child.prefix) {
+		newChild, added := child.insert(search[common:], entry)
+		c.children[idx] = newChild
+		return c, added
+	}
+
+	// 只有部分前綴相同，拆出一個中間節點
+	rest := child.clone()
+	rest.prefix = child.prefix[common:]
+	split := &radixNode{prefix: search[:common], children: []*radixNode{rest}}
+
+	if search[common:] == "" {
+		split.leaf = true
+		split.entry = entry
+	} else {
+		split, _ = split.insert(search[common:], entry)
+	}
+	c.children[idx] = split
+	return c, true
+}
+
+// delete 返回刪除 key 之後的新版本，以及 key 原本是否存在
+func (t *radixTree) delete(key string) (*radixTree, bool) {
+	root, removed := t.root.delete(key, true)
+	if !removed {
+		return t, false
+	}
+	if root == nil {
+		root = &radixNode{}
+	}
+	return &radixTree{root: root, size: t.size - 1}, true
+}
+
+// delete 返回刪除後的節點副本；節點不再需要時返回 nil，只剩一個子節點時與子節點合併
+func (n *radixNode) delete(search string, isRoot bool) (*radixNode, bool) {
+	var c *radixNode
+	if search == "" {
+		if !n.leaf {
+			return n, false
+		}
+		c = n.clone()
+		c.leaf = false
+		c.entry = KeyDirEntry{}
+	} else {
+		idx, child := n.findChild(search[0])
+		if child == nil || !strings.HasPrefix(search, child.prefix) {
+			return n, false
+		}
+		newChild, removed := child.delete(search[len(child.prefix):], false)
+		if !removed {
+			return n, false
+		}
+		c = n.clone()
+		if newChild == nil {
+			c.children = append(c.children[:idx], c.children[idx+1:]...)
+		} else {
+			c.children[idx] = newChild
+		}
+	}
+
+	if isRoot || c.leaf {
+		return c, true
+	}
+	switch len(c.children) {
+	case 0:
+		return nil, true
+	case 1:
+		child := c.children[0]
+		merged := child.clone()
+		merged.prefix = c.prefix + child.prefix
+		return merged, true
+	}
+	return c, true
+}
+
+// ascend 依字典序走訪大於 from（inclusive 時包含等於）的 key，fn 返回 false 時停止
+func (t *radixTree) ascend(from string, inclusive bool, fn func(key string, entry KeyDirEntry) bool) {
+	t.root.ascend("", from, inclusive, fn)
+}
+
+func (n *radixNode) ascend(path, from string, inclusive bool, fn func(string, KeyDirEntry) bool) bool {
+	// 子樹中所有 key 都以 path 開頭：path 小於 from 且不是 from 的前綴時，整棵子樹都小於 from
+	if path < from && !strings.HasPrefix(from, path) {
+		return true
+	}
+	if n.leaf && (path > from || (inclusive && path == from)) {
+		if !fn(path, n.entry) {
+			return false
+		}
+	}
+	for _, child := range n.children {
+		if !child.ascend(path+child.prefix, from, inclusive, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// descend 依字典序由大到小走訪小於 from（inclusive 時包含等於）的 key；
+// bounded 為 false 時忽略 from，從最大的 key 開始走訪
+func (t *radixTree) descend(from string, inclusive, bounded bool, fn func(key string, entry KeyDirEntry) bool) {
+	t.root.descend("", from, inclusive, bounded, fn)
+}
+
+func (n *radixNode) descend(path, from string, inclusive, bounded bool, fn func(string, KeyDirEntry) bool) bool {
+	// 子樹中所有 key 都大於或等於 path
+	if bounded && (path > from || (!inclusive && path == from)) {
+		return true
+	}
+	for i := len(n.children) - 1; i >= 0; i-- {
+		child := n.children[i]
+		if !child.descend(path+child.prefix, from, inclusive, bounded, fn) {
+			return false
+		}
+	}
+	if n.leaf {
+		return fn(path, n.entry)
+	}
+	return true
+}
+
+// commonPrefixLen 返回兩個字串共同前綴的長度
+func commonPrefixLen(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// prefixSuccessor 返回大於所有以 prefix 開頭之 key 的最小字串，不存在時返回 false
+func prefixSuccessor(prefix string) (string, bool) {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1]), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,164 @@
+package bitcask
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 以隨機操作比對基數樹與排序後的 map，驗證插入、刪除與走訪順序
+func TestRadixTreeRandomized(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tree := newRadixTree()
+	want := make(map[string]KeyDirEntry)
+
+	alphabet := []byte("ab:\x00\xff")
+	randomKey := func() string {
+		b := make([]byte, rng.Intn(6))
+		for i := range b {
+			b[i] = alphabet[rng.Intn(len(alphabet))]
+		}
+		return string(b)
+	}
+
+	for i := 0; i < 5000; i++ {
+		key := randomKey()
+		if rng.Intn(3) == 0 {
+			_, existed := want[key]
+			var removed bool
+			tree, removed = tree.delete(key)
+			assert.Equal(t, existed, removed)
+			delete(want, key)
+		} else {
+			entry := KeyDirEntry{ValuePos: int64(i)}
+			tree = tree.insert(key, entry)
+			want[key] = entry
+		}
+	}
+
+	require.Equal(t, len(want), tree.size)
+
+	sorted := make([]string, 0, len(want))
+	for key := range want {
+		sorted = append(sorted, key)
+		entry, ok := tree.get(key)
+		require.True(t, ok)
+		assert.Equal(t, want[key], entry)
+	}
+	sort.Strings(sorted)
+
+	var got []string
+	tree.ascend("", true, func(key string, _ KeyDirEntry) bool {
+		got = append(got, key)
+		return true
+	})
+	assert.Equal(t, sorted, got)
+
+	got = got[:0]
+	tree.descend("", false, false, func(key string, _ KeyDirEntry) bool {
+		got = append(got, key)
+		return true
+	})
+	for i, j := 0, len(got)-1; i < j; i, j = i+1, j-1 {
+		got[i], got[j] = got[j], got[i]
+	}
+	assert.Equal(t, sorted, got)
+
+	// 從任意位置開始的走訪都應與排序結果一致
+	for i := 0; i < 100; i++ {
+		from := randomKey()
+		idx := sort.SearchStrings(sorted, from)
+
+		var first string
+		tree.ascend(from, true, func(key string, _ KeyDirEntry) bool {
+			first = key
+			return false
+		})
+		if idx < len(sorted) {
+			assert.Equal(t, sorted[idx], first, "ascend from %q", from)
+		}
+
+		var last string
+		found := false
+		tree.descend(from, false, true, func(key string, _ KeyDirEntry) bool {
+			last, found = key, true
+			return false
+		})
+		if idx > 0 {
+			assert.Equal(t, sorted[idx-1], last, "descend from %q", from)
+		} else {
+			assert.False(t, found, fmt.Sprintf("descend from %q", from))
+		}
+	}
+}
+
+func TestPrefixSuccessor(t *testing.T) {
+	succ, ok := prefixSuccessor("user:")
+	assert.True(t, ok)
+	assert.Equal(t, "user;", succ)
+
+	succ, ok = prefixSuccessor("a\xff")
+	assert.True(t, ok)
+	assert.Equal(t, "b", succ)
+
+	_, ok = prefixSuccessor("\xff\xff")
+	assert.False(t, ok)
+	_, ok = prefixSuccessor("")
+	assert.False(t, ok)
+}
+
+func TestRadixTreeVersionsAreImmutable(t *testing.T) {
+	v1 := newRadixTree().insert("a", KeyDirEntry{ValuePos: 1}).insert("ab", KeyDirEntry{ValuePos: 2})
+	v2 := v1.insert("ab", KeyDirEntry{ValuePos: 3}).insert("abc", KeyDirEntry{ValuePos: 4})
+	v3, removed := v2.delete("a")
+	require.True(t, removed)
+
+	entry, ok := v1.get("ab")
+	require.True(t, ok)
+	assert.Equal(t, int64(2), entry.ValuePos)
+	_, ok = v1.get("abc")
+	assert.False(t, ok)
+	assert.Equal(t, 2, v1.size)
+
+	entry, ok = v2.get("a")
+	require.True(t, ok)
+	assert.Equal(t, int64(1), entry.ValuePos)
+	assert.Equal(t, 3, v2.size)
+
+	_, ok = v3.get("a")
+	assert.False(t, ok)
+	entry, ok = v3.get("abc")
+	require.True(t, ok)
+	assert.Equal(t, int64(4), entry.ValuePos)
+	assert.Equal(t, 2, v3.size)
+}
+
+func TestKeyDirRemoveExpired(t *testing.T) {
+	kd := NewKeyDir()
+	kd.Put("expired", KeyDirEntry{ExpiresAt: 10})
+	kd.Put("rewritten", KeyDirEntry{ExpiresAt: 10})
+	kd.Put("live", KeyDirEntry{ExpiresAt: 100})
+
+	// 模擬走訪之後、移除之前 key 被重新寫入
+	items := []keyDirUpdate{
+		{key: "expired", entry: KeyDirEntry{ExpiresAt: 10}, delete: true},
+		{key: "rewritten", entry: KeyDirEntry{ExpiresAt: 10}, delete: true},
+	}
+	kd.Put("rewritten", KeyDirEntry{ValuePos: 1})
+	assert.Equal(t, 1, kd.compareAndDelete(items))
+
+	_, ok := kd.tree.get("expired")
+	assert.False(t, ok)
+	entry, ok := kd.tree.get("rewritten")
+	require.True(t, ok)
+	assert.Equal(t, int64(1), entry.ValuePos)
+
+	assert.Zero(t, kd.RemoveExpired(50))
+	kd.Put("expired", KeyDirEntry{ExpiresAt: 10})
+	assert.Equal(t, 1, kd.RemoveExpired(50))
+	assert.Equal(t, 2, kd.Len())
+}
@@ -0,0 +1,309 @@
+package resp
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mahopanda/mini-project/bitcask"
+)
+
+// command 描述一個指令；arity 與 Redis 相同，包含指令名稱本身，
+// 正數表示參數數量必須相等，負數表示至少需要 -arity 個
+type command struct {
+	arity   int
+	handler func(s *Server, w *writer, args [][]byte)
+}
+
+var commands = map[string]command{
+	"PING":   {-1, (*Server).ping},
+	"GET":    {2, (*Server).get},
+	"SET":    {-3, (*Server).set},
+	"DEL":    {-2, (*Server).del},
+	"EXISTS": {-2, (*Server).exists},
+	"KEYS":   {2, (*Server).keys},
+	"SCAN":   {-2, (*Server).scan},
+	"INFO":   {-1, (*Server).info},
+}
+
+// defaultScanCount 為 SCAN 未指定 COUNT 時每次返回的 key 數量
+const defaultScanCount = 10
+
+// dispatch 執行一個指令並寫入回覆，返回是否應關閉連線
+func (s *Server) dispatch(w *writer, args [][]byte) bool {
+	name := strings.ToUpper(string(args[0]))
+	if name == "QUIT" {
+		w.simple("OK")
+		return true
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		w.error(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return false
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		w.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+		return false
+	}
+	cmd.handler(s, w, args)
+	return false
+}
+
+// writeError 將 Bitcask 的錯誤轉換為 Redis 的錯誤回覆
+func writeError(w *writer, err error) {
+	if errors.Is(err, bitcask.ErrReadOnly) {
+		w.error("READONLY " + err.Error())
+		return
+	}
+	w.error("ERR " + err.Error())
+}
+
+func (s *Server) ping(w *writer, args [][]byte) {
+	switch len(args) {
+	case 1:
+		w.simple("PONG")
+	case 2:
+		w.bulk(args[1])
+	default:
+		w.error("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func (s *Server) get(w *writer, args [][]byte) {
+	value, err := s.db.Get(args[1])
+	switch {
+	case errors.Is(err, bitcask.ErrKeyNotFound):
+		w.null()
+	case err != nil:
+		writeError(w, err)
+	default:
+		w.bulk(value)
+	}
+}
+
+// set 支援 SET key value [EX seconds | PX milliseconds]
+func (s *Server) set(w *writer, args [][]byte) {
+	var ttl time.Duration
+	for i := 3; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i]))
+		if (opt != "EX" && opt != "PX") || ttl != 0 || i+1 >= len(args) {
+			w.error("ERR syntax error")
+			return
+		}
+		i++
+		n, err := strconv.ParseInt(string(args[i]), 10, 64)
+		if err != nil || n <= 0 {
+			w.error("ERR invalid expire time in 'set' command")
+			return
+		}
+		if opt == "EX" {
+			ttl = time.Duration(n) * time.Second
+		} else {
+			ttl = time.Duration(n) * time.Millisecond
+		}
+	}
+
+	var err error
+	if ttl > 0 {
+		err = s.db.PutWithTTL(args[1], args[2], ttl)
+	} else {
+		err = s.db.Put(args[1], args[2])
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.simple("OK")
+}
+
+// del 返回實際被刪除的 key 數量
+func (s *Server) del(w *writer, args [][]byte) {
+	var n int64
+	for _, key := range args[1:] {
+		err := s.db.Delete(key)
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		n++
+	}
+	w.integer(n)
+}
+
+// exists 返回存在的 key 數量，重複的 key 重複計算
+func (s *Server) exists(w *writer, args [][]byte) {
+	var n int64
+	for _, key := range args[1:] {
+		_, err := s.db.Get(key)
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		n++
+	}
+	w.integer(n)
+}
+
+func (s *Server) keys(w *writer, args [][]byte) {
+	pattern := string(args[1])
+	var matched []string
+	for _, key := range s.db.Scan([]byte(literalPrefix(pattern))) {
+		if matchGlob(pattern, key) {
+			matched = append(matched, key)
+		}
+	}
+	w.bulkStrings(matched)
+}
+
+// scan 支援 SCAN cursor [MATCH pattern] [COUNT count]。
+// cursor 編碼上一次檢查到的最後一個 key，下一次從索引中緊接在它之後的 key 繼續，
+// 每次最多檢查 count 個 key。走訪期間一直存在的 key 一定會被返回，不受其他 key 的新增或刪除影響。
+func (s *Server) scan(w *writer, args [][]byte) {
+	after, resume, ok := decodeCursor(string(args[1]))
+	if !ok {
+		w.error("ERR invalid cursor")
+		return
+	}
+
+	pattern, count := "*", defaultScanCount
+	var err error
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			w.error("ERR syntax error")
+			return
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = string(args[i+1])
+		case "COUNT":
+			count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil || count <= 0 {
+				w.error("ERR value is not an integer or out of range")
+				return
+			}
+		default:
+			w.error("ERR syntax error")
+			return
+		}
+	}
+
+	// 不符合固定前綴的 key 不可能匹配，只需要走訪前綴範圍內的 key
+	it := s.db.NewIterator(bitcask.IteratorOptions{Prefix: []byte(literalPrefix(pattern))})
+	if resume {
+		it.Seek([]byte(after))
+		if it.Valid() && string(it.Key()) == after {
+			it.Next()
+		}
+	}
+
+	var matched []string
+	var last string
+	for n := 0; n < count && it.Valid(); n++ {
+		last = string(it.Key())
+		if matchGlob(pattern, last) {
+			matched = append(matched, last)
+		}
+		it.Next()
+	}
+
+	next := "0"
+	if it.Valid() {
+		next = encodeCursor(last)
+	}
+	w.array(2)
+	w.bulk([]byte(next))
+	w.bulkStrings(matched)
+}
+
+// encodeCursor 將 key 編碼為 SCAN 的 cursor。
+// 許多用戶端會把 cursor 解析為整數，因此以十進位表示 0x01 加上 key 的位元組組成的大整數，
+// 開頭的 0x01 保留 key 開頭的零位元組，也讓結果不會是代表走訪結束的 0。
+func encodeCursor(key string) string {
+	return new(big.Int).SetBytes(append([]byte{1}, key...)).String()
+}
+
+// decodeCursor 解析 SCAN 的 cursor，返回上次的最後一個 key 與是否需要從它之後繼續；
+// cursor 為 0 表示從頭開始
+func decodeCursor(cursor string) (string, bool, bool) {
+	if cursor == "0" {
+		return "", false, true
+	}
+	n, ok := new(big.Int).SetString(cursor, 10)
+	if !ok || n.Sign() <= 0 {
+		return "", false, false
+	}
+	b := n.Bytes()
+	if b[0] != 1 {
+		return "", false, false
+	}
+	return string(b[1:]), true, true
+}
+
+// info 回報伺服器與儲存的狀態，可指定只返回某一個區段
+func (s *Server) info(w *writer, args [][]byte) {
+	if len(args) > 2 {
+		w.error("ERR syntax error")
+		return
+	}
+	section := "all"
+	if len(args) == 2 {
+		section = strings.ToLower(string(args[1]))
+	}
+
+	stats, err := s.db.Stats()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	sections := []struct {
+		name   string
+		fields []string
+	}{
+		{"server", []string{
+			fmt.Sprintf("uptime_in_seconds:%d", int64(time.Since(s.started).Seconds())),
+		}},
+		{"clients", []string{
+			fmt.Sprintf("connected_clients:%d", s.connectedClients()),
+		}},
+		{"stats", []string{
+			fmt.Sprintf("total_connections_received:%d", s.totalConns.Load()),
+			fmt.Sprintf("total_commands_processed:%d", s.totalCommands.Load()),
+		}},
+		{"bitcask", []string{
+			fmt.Sprintf("segments:%d", len(stats.Segments)),
+			fmt.Sprintf("total_bytes:%d", stats.TotalBytes),
+			fmt.Sprintf("live_bytes:%d", stats.LiveBytes),
+			fmt.Sprintf("dead_bytes:%d", stats.DeadBytes),
+			fmt.Sprintf("fragmentation:%.4f", stats.Fragmentation),
+		}},
+		{"keyspace", []string{
+			fmt.Sprintf("db0:keys=%d", stats.LiveKeys),
+		}},
+	}
+
+	var sb strings.Builder
+	for _, sec := range sections {
+		if section != "all" && section != "default" && section != "everything" && section != sec.name {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteString("\r\n")
+		}
+		sb.WriteString("# " + strings.ToUpper(sec.name[:1]) + sec.name[1:] + "\r\n")
+		for _, f := range sec.fields {
+			sb.WriteString(f + "\r\n")
+		}
+	}
+	w.bulk([]byte(sb.String()))
+}
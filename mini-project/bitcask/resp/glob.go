@@ -0,0 +1,98 @@
+package resp
+
+// matchGlob 以 Redis KEYS 的規則比對 pattern：
+// * 匹配任意長度的字元、? 匹配單一字元、[abc] 與 [a-z] 匹配字元集合（[^...] 表示排除），
+// \ 跳脫下一個字元。與 path.Match 不同，/ 沒有特殊意義。
+// 比對以兩個指標進行，遇到 * 時記住位置，之後失敗只回溯到最近的 * 並讓它多匹配一個字元，
+// 因此時間複雜度為 O(len(pattern)*len(s))，不會因為多個 * 而呈指數成長。
+func matchGlob(pattern, s string) bool {
+	p, i := 0, 0
+	star, starI := -1, 0 // 最近一個 * 在 pattern 中的位置，以及它目前匹配到 s 的哪裡
+	for i < len(s) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				star, starI = p, i
+				p++
+				continue
+			case '?':
+				p, i = p+1, i+1
+				continue
+			case '[':
+				if matched, rest := matchClass(pattern[p+1:], s[i]); matched {
+					p, i = len(pattern)-len(rest), i+1
+					continue
+				}
+			default:
+				c, n := pattern[p], 1
+				if c == '\\' && p+1 < len(pattern) {
+					c, n = pattern[p+1], 2
+				}
+				if c == s[i] {
+					p, i = p+n, i+1
+					continue
+				}
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		starI++
+		p, i = star+1, starI
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchClass 比對 [...] 字元集合，pattern 從 [ 之後開始，返回是否匹配與 ] 之後剩下的 pattern
+func matchClass(pattern string, c byte) (bool, string) {
+	negate := len(pattern) > 0 && pattern[0] == '^'
+	if negate {
+		pattern = pattern[1:]
+	}
+
+	matched := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		lo := pattern[0]
+		if lo == '\\' && len(pattern) > 1 {
+			pattern = pattern[1:]
+			lo = pattern[0]
+		}
+		pattern = pattern[1:]
+
+		hi := lo
+		if len(pattern) > 1 && pattern[0] == '-' && pattern[1] != ']' {
+			hi = pattern[1]
+			pattern = pattern[2:]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+		}
+		if lo <= c && c <= hi {
+			matched = true
+		}
+	}
+	if len(pattern) > 0 {
+		pattern = pattern[1:] // 略過 ]
+	}
+	return matched != negate, pattern
+}
+
+// literalPrefix 返回 pattern 在第一個萬用字元之前的固定前綴，用來縮小需要比對的 key 範圍
+func literalPrefix(pattern string) string {
+	var prefix []byte
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*', '?', '[':
+			return string(prefix)
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+		}
+		prefix = append(prefix, pattern[i])
+	}
+	return string(prefix)
+}
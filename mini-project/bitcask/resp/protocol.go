@@ -0,0 +1,179 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxBulkLen   = 512 << 20 // 單一 bulk string 的上限，與 Redis 相同
+	maxArrayLen  = 1 << 20   // 單一指令的參數數量上限
+	maxInlineLen = 64 << 10  // inline 指令的長度上限
+)
+
+// ErrProtocol 表示用戶端送出的資料不符合 RESP 格式，連線會在回覆錯誤後關閉
+var ErrProtocol = errors.New("protocol error")
+
+// reader 從連線讀取 RESP2 指令：一般用戶端送出 bulk string 陣列，
+// 也接受 telnet 等工具直接輸入的 inline 指令（以空白分隔參數）
+type reader struct {
+	br *bufio.Reader
+}
+
+func newReader(r io.Reader) *reader {
+	return &reader{br: bufio.NewReader(r)}
+}
+
+// buffered 返回已讀入緩衝區但尚未解析的位元組數，大於 0 表示還有管線化的指令
+func (r *reader) buffered() int {
+	return r.br.Buffered()
+}
+
+// readCommand 讀取一個指令，空行與空陣列返回長度為 0 的參數
+func (r *reader) readCommand() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return inlineArgs(line), nil
+	}
+
+	n, err := parseLength(line[1:], maxArrayLen)
+	if err != nil {
+		return nil, err
+	}
+	args := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		arg, err := r.readBulk()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// readBulk 讀取一個 $<長度>\r\n<資料>\r\n 格式的 bulk string
+func (r *reader) readBulk() ([]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '$' {
+		return nil, fmt.Errorf("%w: expected '$', got %q", ErrProtocol, line)
+	}
+	n, err := parseLength(line[1:], maxBulkLen)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, n+2)
+	if _, err := io.ReadFull(r.br, buf); err != nil {
+		return nil, err
+	}
+	if buf[n] != '\r' || buf[n+1] != '\n' {
+		return nil, fmt.Errorf("%w: bulk string is not terminated by CRLF", ErrProtocol)
+	}
+	return buf[:n], nil
+}
+
+// readLine 讀取一行並去除結尾的 \r\n
+func (r *reader) readLine() (string, error) {
+	var sb strings.Builder
+	for {
+		chunk, isPrefix, err := r.br.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		sb.Write(chunk)
+		if sb.Len() > maxInlineLen {
+			return "", fmt.Errorf("%w: too big inline request", ErrProtocol)
+		}
+		if !isPrefix {
+			return sb.String(), nil
+		}
+	}
+}
+
+// parseLength 解析陣列或 bulk string 的長度
+func parseLength(s string, limit int) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > limit {
+		return 0, fmt.Errorf("%w: invalid length %q", ErrProtocol, s)
+	}
+	return n, nil
+}
+
+// inlineArgs 將 inline 指令依空白切成參數
+func inlineArgs(line string) [][]byte {
+	fields := strings.Fields(line)
+	args := make([][]byte, len(fields))
+	for i, f := range fields {
+		args[i] = []byte(f)
+	}
+	return args
+}
+
+// writer 將回覆以 RESP2 格式寫入緩衝區，由呼叫端決定何時 Flush
+type writer struct {
+	bw *bufio.Writer
+}
+
+func newWriter(w io.Writer) *writer {
+	return &writer{bw: bufio.NewWriter(w)}
+}
+
+func (w *writer) simple(s string) {
+	w.bw.WriteByte('+')
+	w.bw.WriteString(s)
+	w.bw.WriteString("\r\n")
+}
+
+func (w *writer) error(msg string) {
+	w.bw.WriteByte('-')
+	// 錯誤訊息不能包含換行，否則會破壞協定格式
+	w.bw.WriteString(strings.NewReplacer("\r", " ", "\n", " ").Replace(msg))
+	w.bw.WriteString("\r\n")
+}
+
+func (w *writer) integer(n int64) {
+	w.bw.WriteByte(':')
+	w.bw.WriteString(strconv.FormatInt(n, 10))
+	w.bw.WriteString("\r\n")
+}
+
+func (w *writer) bulk(b []byte) {
+	w.bw.WriteByte('$')
+	w.bw.WriteString(strconv.Itoa(len(b)))
+	w.bw.WriteString("\r\n")
+	w.bw.Write(b)
+	w.bw.WriteString("\r\n")
+}
+
+// null 寫入 null bulk string，表示 key 不存在
+func (w *writer) null() {
+	w.bw.WriteString("$-1\r\n")
+}
+
+// array 寫入陣列的長度，之後由呼叫端依序寫入 n 個元素
+func (w *writer) array(n int) {
+	w.bw.WriteByte('*')
+	w.bw.WriteString(strconv.Itoa(n))
+	w.bw.WriteString("\r\n")
+}
+
+func (w *writer) bulkStrings(items []string) {
+	w.array(len(items))
+	for _, s := range items {
+		w.bulk([]byte(s))
+	}
+}
+
+func (w *writer) flush() error {
+	return w.bw.Flush()
+}
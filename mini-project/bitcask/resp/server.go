@@ -0,0 +1,222 @@
+// resp 套件以 Redis 的 RESP2 協定對外提供 Bitcask 的存取，
+// 讓現有的 Redis 用戶端可以直接連線使用。
+package resp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Mahopanda/mini-project/bitcask"
+)
+
+// ErrServerClosed 表示伺服器已經關閉，由 Serve 在 Shutdown 或 Close 之後返回
+var ErrServerClosed = errors.New("resp: server closed")
+
+// Server 為 RESP2 的 TCP 伺服器，每個連線由一個 goroutine 依序處理指令。
+// 同一連線上管線化 (pipelining) 送來的多個指令會在全部處理完後一次寫出回覆。
+// Server 不負責關閉底層的 Bitcask，由呼叫端在 Shutdown 之後自行關閉。
+type Server struct {
+	db      *bitcask.Bitcask
+	started time.Time
+
+	mu        sync.Mutex
+	closing   bool
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup // 追蹤處理中的連線
+
+	totalConns    atomic.Int64
+	totalCommands atomic.Int64
+}
+
+// NewServer 建立一個以 db 為儲存的伺服器
+func NewServer(db *bitcask.Bitcask) *Server {
+	return &Server{
+		db:        db,
+		started:   time.Now(),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe 監聽 addr 並開始提供服務
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve 在 l 上接受連線直到伺服器關閉，關閉後返回 ErrServerClosed
+func (s *Server) Serve(l net.Listener) error {
+	if !s.trackListener(l) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer s.untrackListener(l)
+
+	var delay time.Duration
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			if s.isClosing() {
+				return ErrServerClosed
+			}
+			// 暫時性的錯誤（例如檔案描述子用盡）稍後重試
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				delay = min(max(2*delay, 5*time.Millisecond), time.Second)
+				time.Sleep(delay)
+				continue
+			}
+			return err
+		}
+		delay = 0
+
+		if !s.trackConn(nc) {
+			nc.Close()
+			return ErrServerClosed
+		}
+		go s.serveConn(nc)
+	}
+}
+
+// Shutdown 停止接受新連線，並等待每個連線處理完已收到的指令後關閉。
+// 等待中的連線不會再讀取新的指令；ctx 結束時強制關閉剩下的連線並返回 ctx 的錯誤。
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	// 讓阻塞在讀取上的連線立即返回，正在處理指令的連線則在寫出回覆後結束
+	for nc := range s.conns {
+		nc.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.closeConns()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Close 立即關閉所有監聽與連線，不等待處理中的指令
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closing = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	s.mu.Unlock()
+
+	s.closeConns()
+	s.wg.Wait()
+	return nil
+}
+
+// serveConn 依序讀取並執行連線上的指令，緩衝區中沒有待處理的指令時才寫出回覆。
+// 讀取失敗時（例如用戶端關閉寫入端或 Shutdown 設定的期限到達）仍會先寫出已執行指令的回覆。
+func (s *Server) serveConn(nc net.Conn) {
+	defer s.untrackConn(nc)
+
+	r := newReader(nc)
+	w := newWriter(nc)
+	for {
+		args, err := r.readCommand()
+		if err != nil {
+			if errors.Is(err, ErrProtocol) {
+				w.error("ERR " + err.Error())
+			}
+			w.flush()
+			return
+		}
+
+		quit := false
+		if len(args) > 0 {
+			s.totalCommands.Add(1)
+			quit = s.dispatch(w, args)
+		}
+
+		if quit || r.buffered() == 0 {
+			if err := w.flush(); err != nil {
+				return
+			}
+			if quit || s.isClosing() {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) isClosing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closing
+}
+
+func (s *Server) trackListener(l net.Listener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.listeners[l] = struct{}{}
+	return true
+}
+
+func (s *Server) untrackListener(l net.Listener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.listeners, l)
+}
+
+func (s *Server) trackConn(nc net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.conns[nc] = struct{}{}
+	s.wg.Add(1)
+	s.totalConns.Add(1)
+	return true
+}
+
+func (s *Server) untrackConn(nc net.Conn) {
+	nc.Close()
+	s.mu.Lock()
+	delete(s.conns, nc)
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+func (s *Server) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for nc := range s.conns {
+		nc.Close()
+	}
+}
+
+// connectedClients 返回目前的連線數
+func (s *Server) connectedClients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
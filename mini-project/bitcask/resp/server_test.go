@@ -0,0 +1,325 @@
+package resp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mahopanda/mini-project/bitcask"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startServer 在 loopback 的隨機埠上啟動伺服器，測試結束時關閉伺服器與資料庫
+func startServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	db, err := bitcask.NewBitcask(t.TempDir(), bitcask.WithSweepInterval(0))
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := NewServer(db)
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(l) }()
+
+	t.Cleanup(func() {
+		srv.Close()
+		assert.ErrorIs(t, <-done, ErrServerClosed)
+		db.Close()
+	})
+	return srv, l.Addr().String()
+}
+
+// client 為測試用的簡易 RESP 用戶端
+type client struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dial(t *testing.T, addr string) *client {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return &client{conn: conn, br: bufio.NewReader(conn)}
+}
+
+func encodeCommand(args ...string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return sb.String()
+}
+
+func (c *client) do(t *testing.T, args ...string) any {
+	t.Helper()
+	_, err := c.conn.Write([]byte(encodeCommand(args...)))
+	require.NoError(t, err)
+	return c.read(t)
+}
+
+// read 讀取一個回覆：simple string 與 bulk string 返回 string，錯誤返回 error，
+// 整數返回 int64，null 返回 nil，陣列返回 []any
+func (c *client) read(t *testing.T) any {
+	t.Helper()
+	line, err := c.br.ReadString('\n')
+	require.NoError(t, err)
+	line = strings.TrimSuffix(line, "\r\n")
+
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return fmt.Errorf("%s", line[1:])
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		require.NoError(t, err)
+		return n
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		require.NoError(t, err)
+		if n < 0 {
+			return nil
+		}
+		buf := make([]byte, n+2)
+		_, err = io.ReadFull(c.br, buf)
+		require.NoError(t, err)
+		return string(buf[:n])
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		require.NoError(t, err)
+		items := make([]any, n)
+		for i := range items {
+			items[i] = c.read(t)
+		}
+		return items
+	}
+	t.Fatalf("unexpected reply %q", line)
+	return nil
+}
+
+func TestCommands(t *testing.T) {
+	_, addr := startServer(t)
+	c := dial(t, addr)
+
+	assert.Equal(t, "PONG", c.do(t, "PING"))
+	assert.Equal(t, "hello", c.do(t, "ping", "hello"))
+
+	assert.Equal(t, "OK", c.do(t, "SET", "user:1", "alice"))
+	assert.Equal(t, "OK", c.do(t, "SET", "user:2", "bob"))
+	assert.Equal(t, "OK", c.do(t, "SET", "order:1", "book"))
+	assert.Equal(t, "alice", c.do(t, "GET", "user:1"))
+	assert.Nil(t, c.do(t, "GET", "missing"))
+
+	assert.Equal(t, int64(2), c.do(t, "EXISTS", "user:1", "user:2", "missing"))
+	assert.Equal(t, []any{"user:1", "user:2"}, c.do(t, "KEYS", "user:*"))
+	assert.Equal(t, []any{"order:1", "user:1", "user:2"}, c.do(t, "KEYS", "*"))
+	assert.Equal(t, []any{"user:2"}, c.do(t, "KEYS", "*[2-9]"))
+
+	assert.Equal(t, int64(1), c.do(t, "DEL", "user:2", "missing"))
+	assert.Nil(t, c.do(t, "GET", "user:2"))
+
+	// 過期的 key 不可見
+	assert.Equal(t, "OK", c.do(t, "SET", "session", "token", "PX", "10"))
+	assert.Eventually(t, func() bool {
+		return c.do(t, "GET", "session") == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "OK", c.do(t, "SET", "session", "token", "ex", "60"))
+	assert.Equal(t, "token", c.do(t, "GET", "session"))
+
+	assert.EqualError(t, c.do(t, "SET", "k", "v", "EX", "0").(error), "ERR invalid expire time in 'set' command")
+	assert.EqualError(t, c.do(t, "SET", "k", "v", "NX").(error), "ERR syntax error")
+	assert.EqualError(t, c.do(t, "GET").(error), "ERR wrong number of arguments for 'get' command")
+	assert.EqualError(t, c.do(t, "FLUSHALL").(error), "ERR unknown command 'FLUSHALL'")
+
+	info := c.do(t, "INFO").(string)
+	assert.Contains(t, info, "# Keyspace\r\ndb0:keys=3\r\n")
+	assert.Contains(t, info, "connected_clients:1")
+	assert.NotContains(t, c.do(t, "INFO", "keyspace").(string), "# Server")
+
+	assert.Equal(t, "OK", c.do(t, "QUIT"))
+	_, err := c.br.ReadByte()
+	assert.Error(t, err)
+}
+
+func TestScan(t *testing.T) {
+	_, addr := startServer(t)
+	c := dial(t, addr)
+
+	for i := 0; i < 25; i++ {
+		require.Equal(t, "OK", c.do(t, "SET", fmt.Sprintf("key:%02d", i), "v"))
+	}
+
+	var keys []any
+	cursor := "0"
+	for {
+		reply := c.do(t, "SCAN", cursor, "MATCH", "key:1*", "COUNT", "7").([]any)
+		keys = append(keys, reply[1].([]any)...)
+		cursor = reply[0].(string)
+		if cursor == "0" {
+			break
+		}
+	}
+	assert.Len(t, keys, 10)
+	assert.Equal(t, "key:10", keys[0])
+
+	// 每次呼叫之間刪除已返回的 key 並新增 key，始終存在的 key 仍然全部會被返回
+	seen := make(map[string]bool)
+	cursor = "0"
+	for round := 0; ; round++ {
+		reply := c.do(t, "SCAN", cursor, "COUNT", "3").([]any)
+		for _, key := range reply[1].([]any) {
+			seen[key.(string)] = true
+		}
+		require.Equal(t, int64(1), c.do(t, "DEL", fmt.Sprintf("key:%02d", round)))
+		require.Equal(t, "OK", c.do(t, "SET", fmt.Sprintf("added:%02d", round), "v"))
+		cursor = reply[0].(string)
+		if cursor == "0" {
+			break
+		}
+	}
+	for i := 0; i < 25; i++ {
+		assert.True(t, seen[fmt.Sprintf("key:%02d", i)], "key:%02d", i)
+	}
+
+	assert.Equal(t, fmt.Errorf("ERR invalid cursor"), c.do(t, "SCAN", "abc"))
+	assert.Equal(t, fmt.Errorf("ERR invalid cursor"), c.do(t, "SCAN", "2"))
+}
+
+func TestScanCursor(t *testing.T) {
+	for _, key := range []string{"", "a", "\x00\x00key", "user:1"} {
+		cursor := encodeCursor(key)
+		assert.Regexp(t, "^[1-9][0-9]*$", cursor)
+		got, resume, ok := decodeCursor(cursor)
+		require.True(t, ok)
+		assert.True(t, resume)
+		assert.Equal(t, key, got)
+	}
+	_, resume, ok := decodeCursor("0")
+	assert.True(t, ok)
+	assert.False(t, resume)
+}
+
+func TestPipelining(t *testing.T) {
+	_, addr := startServer(t)
+	c := dial(t, addr)
+
+	// 多個指令一次送出，回覆依序返回；也接受 inline 指令
+	pipeline := encodeCommand("SET", "a", "1") + encodeCommand("SET", "b", "2") +
+		encodeCommand("GET", "a") + "PING\r\n" + encodeCommand("GET", "b")
+	_, err := c.conn.Write([]byte(pipeline))
+	require.NoError(t, err)
+
+	assert.Equal(t, "OK", c.read(t))
+	assert.Equal(t, "OK", c.read(t))
+	assert.Equal(t, "1", c.read(t))
+	assert.Equal(t, "PONG", c.read(t))
+	assert.Equal(t, "2", c.read(t))
+}
+
+func TestPipelineFlushedOnReadError(t *testing.T) {
+	_, addr := startServer(t)
+	c := dial(t, addr)
+
+	// 完整的 SET 之後緊接著不完整的指令，再關閉寫入端，SET 的回覆仍然要送達
+	pipeline := encodeCommand("SET", "a", "1") + "*2\r\n$3\r\nGE"
+	_, err := c.conn.Write([]byte(pipeline))
+	require.NoError(t, err)
+	require.NoError(t, c.conn.(*net.TCPConn).CloseWrite())
+
+	assert.Equal(t, "OK", c.read(t))
+	_, err = c.br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestProtocolError(t *testing.T) {
+	_, addr := startServer(t)
+	c := dial(t, addr)
+
+	_, err := c.conn.Write([]byte("*1\r\n$abc\r\n"))
+	require.NoError(t, err)
+	reply := c.read(t)
+	require.IsType(t, fmt.Errorf(""), reply)
+	assert.Contains(t, reply.(error).Error(), "ERR protocol error")
+
+	// 協定錯誤後連線會被關閉
+	_, err = c.br.ReadByte()
+	assert.Error(t, err)
+}
+
+func TestShutdown(t *testing.T) {
+	srv, addr := startServer(t)
+	idle := dial(t, addr)
+	busy := dial(t, addr)
+	require.Equal(t, "PONG", idle.do(t, "PING"))
+
+	// 在 Shutdown 前已送出的指令仍會得到回覆
+	_, err := busy.conn.Write([]byte(encodeCommand("SET", "k", "v")))
+	require.NoError(t, err)
+	assert.Equal(t, "OK", busy.read(t))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, srv.Shutdown(ctx))
+
+	_, err = idle.br.ReadByte()
+	assert.Error(t, err)
+	_, err = net.Dial("tcp", addr)
+	assert.Error(t, err)
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "", true},
+		{"*", "a/b", true},
+		{"user:*", "user:1", true},
+		{"user:*", "order:1", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"*:*:end", "a:b:end", true},
+		{"*:*:end", "a:b:en", false},
+		{"a*b*c", "abxbc", true},
+		{"a*b?c", "abxbc", false},
+		{"a*[0-9]", "abc9", true},
+		{"*\\*", "a*", true},
+		{"**", "abc", true},
+		{"a*", "", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, matchGlob(tt.pattern, tt.s), "%q %q", tt.pattern, tt.s)
+	}
+
+	// 多個 * 只回溯到最近的一個，長字串也能在線性倍數的時間內比對完
+	done := make(chan bool, 1)
+	go func() { done <- matchGlob("*a*a*a*a*a*a*a*a*a*a*b", strings.Repeat("a", 10000)) }()
+	select {
+	case matched := <-done:
+		assert.False(t, matched)
+	case <-time.After(5 * time.Second):
+		t.Fatal("matchGlob did not finish")
+	}
+	assert.True(t, matchGlob("*a*a*a*b", strings.Repeat("a", 100)+"b"))
+
+	assert.Equal(t, "user:", literalPrefix("user:*"))
+	assert.Equal(t, "a*b", literalPrefix("a\\*b"))
+	assert.Equal(t, "", literalPrefix("[ab]c"))
+}
@@ -0,0 +1,223 @@
+package bitcask
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// 資料段檔案的副檔名，檔名為九位數的段編號，例如 000000001.data
+const dataFileExt = ".data"
+
+// errKeyMismatch 表示索引指向的 Entry 與查詢的 key 不同
+var errKeyMismatch = errors.New("key mismatch")
+
+// ErrCorrupt 表示資料段在 Offset 處的資料損壞，Err 為具體原因，
+// 例如 ErrChecksum 或 io.ErrUnexpectedEOF，可透過 errors.Is 判斷
+type ErrCorrupt struct {
+	Segment uint32 // 資料段編號
+	Offset  int64  // 損壞資料在資料段中的偏移量
+	Err     error
+}
+
+func (e *ErrCorrupt) Error() string {
+	return fmt.Sprintf("segment %d is corrupted at offset %d: %v", e.Segment, e.Offset, e.Err)
+}
+
+func (e *ErrCorrupt) Unwrap() error {
+	return e.Err
+}
+
+// segment 表示目錄中的一個資料段檔案
+type segment struct {
+	id   uint32
+	path string
+	file *os.File
+	size int64        // 目前檔案的大小，也就是下一筆寫入的偏移量
+	refs atomic.Int32 // 資料庫本身與快照持有的引用數，歸零時關閉檔案
+}
+
+// segmentPath 返回指定編號的資料段檔案路徑
+func segmentPath(dir string, id uint32) string {
+	return filepath.Join(dir, fmt.Sprintf("%09d%s", id, dataFileExt))
+}
+
+// openSegment 開啟（或建立）指定編號的資料段
+func openSegment(dir string, id uint32) (*segment, error) {
+	return openSegmentFile(dir, id, os.O_RDWR|os.O_CREATE)
+}
+
+// openSegmentFile 以指定的 flag 開啟資料段，唯讀模式使用 os.O_RDONLY。
+// 新建立的資料段會先寫入檔頭；既有的資料段會校驗檔頭，格式版本不符時返回包裝 ErrFormat 的錯誤。
+func openSegmentFile(dir string, id uint32, flag int) (*segment, error) {
+	path := segmentPath(dir, id)
+	file, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	seg := &segment{
+		id:   id,
+		path: path,
+		file: file,
+	}
+	if err := seg.initHeader(flag&(os.O_WRONLY|os.O_RDWR) != 0); err != nil {
+		file.Close()
+		return nil, err
+	}
+	seg.refs.Store(1)
+	return seg, nil
+}
+
+// initHeader 校驗資料段的檔頭並設定 size。
+// 長度不足一個檔頭的檔案還沒有任何 Entry，可寫入時補上檔頭，唯讀時視為空的資料段。
+func (s *segment) initHeader(writable bool) error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.Size() < segmentHeaderSize {
+		if writable {
+			if err := s.file.Truncate(0); err != nil {
+				return err
+			}
+			if _, err := s.file.WriteAt(encodeFileHeader(segmentMagic), 0); err != nil {
+				return err
+			}
+		}
+		s.size = segmentHeaderSize
+		return nil
+	}
+
+	version, err := readFileVersion(s.file, info.Size(), segmentMagic)
+	if err != nil {
+		return &ErrCorrupt{Segment: s.id, Offset: 0, Err: err}
+	}
+	if err := checkFileVersion(s.path, version); err != nil {
+		return err
+	}
+	s.size = info.Size()
+	return nil
+}
+
+// empty 判斷資料段是否還沒有任何 Entry
+func (s *segment) empty() bool {
+	return s.size <= segmentHeaderSize
+}
+
+// Close 關閉資料段檔案
+func (s *segment) Close() error {
+	return s.file.Close()
+}
+
+// acquire 增加一個引用，在對應的 release 之前檔案不會被關閉
+func (s *segment) acquire() {
+	s.refs.Add(1)
+}
+
+// release 釋放一個引用，最後一個引用釋放時關閉檔案。
+// 資料段被合併取代後，仍被快照引用的舊檔案會保持開啟直到快照釋放。
+func (s *segment) release() error {
+	if s.refs.Add(-1) == 0 {
+		return s.Close()
+	}
+	return nil
+}
+
+// listSegmentIDs 依編號由小到大列出目錄中的所有資料段
+func listSegmentIDs(dir string) ([]uint32, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint32
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, dataFileExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, dataFileExt), 10, 32)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint32(id))
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// readEntryAt 從 r 的 offset 位置讀出並解碼一筆完整的 Entry。
+// limit 為可讀取的資料尾端，Entry 超出此範圍時返回 io.ErrUnexpectedEOF，
+// 避免損壞的長度欄位造成過大的記憶體配置。
+func readEntryAt(r io.ReaderAt, offset, limit int64) (*Entry, error) {
+	if offset+entryHeaderSize > limit {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	header := make([]byte, entryHeaderSize)
+	if _, err := r.ReadAt(header, offset); err != nil {
+		return nil, err
+	}
+
+	ks := binary.BigEndian.Uint32(header[4:8])
+	vs := binary.BigEndian.Uint32(header[8:12])
+	size := entryHeaderSize + int64(ks) + int64(vs)
+	if offset+size > limit {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	buf := make([]byte, size)
+	copy(buf, header)
+	if _, err := r.ReadAt(buf[entryHeaderSize:], offset+entryHeaderSize); err != nil {
+		return nil, err
+	}
+
+	return Decode(buf)
+}
+
+// readEntry 從資料段讀出一筆 Entry，資料損壞時返回 *ErrCorrupt
+func (s *segment) readEntry(offset, limit int64) (*Entry, error) {
+	entry, err := readEntryAt(s.file, offset, limit)
+	if err == nil {
+		return entry, nil
+	}
+	if errors.Is(err, ErrChecksum) || errors.Is(err, ErrTruncated) || errors.Is(err, io.ErrUnexpectedEOF) || err == io.EOF {
+		return nil, &ErrCorrupt{Segment: s.id, Offset: offset, Err: err}
+	}
+	return nil, err
+}
+
+// scan 從檔頭之後依序解碼資料段中的每一筆 Entry 並呼叫 fn。
+// 返回最後一筆有效 Entry 結束的位置；若在檔案尾端之前遇到短讀或 CRC 錯誤，
+// 一併返回該錯誤，呼叫者可據此截斷損壞的尾端。
+func (s *segment) scan(fn func(e *Entry, offset int64)) (int64, error) {
+	offset := int64(segmentHeaderSize)
+	for offset < s.size {
+		entry, err := readEntryAt(s.file, offset, s.size)
+		if err != nil {
+			return offset, err
+		}
+		fn(entry, offset)
+		offset += entry.Size()
+	}
+	return offset, nil
+}
+
+// truncate 將資料段截斷到 size 並同步到磁碟
+func (s *segment) truncate(size int64) error {
+	if err := s.file.Truncate(size); err != nil {
+		return err
+	}
+	s.size = size
+	return s.file.Sync()
+}
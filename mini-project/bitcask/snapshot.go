@@ -0,0 +1,122 @@
+package bitcask
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrSnapshotReleased 表示快照已經被釋放
+var ErrSnapshotReleased = errors.New("snapshot is released")
+
+// Snapshot 為資料庫在某一時間點的唯讀視圖。
+// 快照保存建立當下的索引版本，並持有所引用資料段的檔案，
+// 之後的 Put、Delete 與 Merge 都不會影響快照看到的 key 與 value。
+// 過期判斷固定以建立快照的時間為準。使用完畢後必須呼叫 Release 釋放資料段。
+type Snapshot struct {
+	mu       sync.RWMutex
+	tree     *radixTree
+	segments map[uint32]*segment // 快照引用的資料段，被合併取代後仍保持開啟
+	now      int64               // 建立快照的時間 (UnixNano)
+	codec    *valueCodec
+	verify   bool
+	released bool
+}
+
+// Snapshot 建立目前狀態的快照。取得索引版本與資料段集合時持有讀鎖，
+// 不會阻擋其他讀取與追加寫入。
+func (bc *Bitcask) Snapshot() (*Snapshot, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if bc.closed {
+		return nil, ErrClosed
+	}
+
+	// 持有 mu 期間資料段集合不會變動，索引版本中的位置都落在這些資料段內
+	s := &Snapshot{
+		tree:     bc.keyDir.snapshot(),
+		segments: make(map[uint32]*segment, len(bc.segments)+1),
+		now:      bc.opts.now().UnixNano(),
+		codec:    bc.codec,
+		verify:   bc.opts.VerifyChecksum,
+	}
+	for id, seg := range bc.segments {
+		seg.acquire()
+		s.segments[id] = seg
+	}
+	bc.active.acquire()
+	s.segments[bc.active.id] = bc.active
+	return s, nil
+}
+
+// Get 取得 key 在快照建立時的值
+func (s *Snapshot) Get(key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.released {
+		return nil, ErrSnapshotReleased
+	}
+
+	pos, exists := s.tree.lookup(string(key), s.now)
+	if !exists {
+		return nil, ErrKeyNotFound
+	}
+	return readValue(s.segments[pos.FileID], s.codec, key, pos, s.verify)
+}
+
+// Len 返回快照中尚未過期的 key 數量
+func (s *Snapshot) Len() int {
+	n := 0
+	s.tree.ascendLive("", s.now, func(string, KeyDirEntry) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// ListKeys 依字典序返回快照中所有尚未過期的 key
+func (s *Snapshot) ListKeys() []string {
+	return s.tree.rangeKeys("", "", s.now)
+}
+
+// Scan 依字典序返回快照中所有以 prefix 開頭且尚未過期的 key
+func (s *Snapshot) Scan(prefix []byte) []string {
+	return s.tree.scanKeys(string(prefix), s.now)
+}
+
+// Range 依字典序返回快照中 [start, end) 之間尚未過期的 key，end 為空表示沒有上限
+func (s *Snapshot) Range(start, end []byte) []string {
+	return s.tree.rangeKeys(string(start), string(end), s.now)
+}
+
+// NewIterator 建立走訪快照內容的迭代器
+func (s *Snapshot) NewIterator(opts IteratorOptions) *Iterator {
+	return newIterator(s, opts)
+}
+
+// seek 在快照的索引版本中查詢迭代方向上的下一個 key
+func (s *Snapshot) seek(from string, inclusive, bounded, reverse bool) (string, KeyDirEntry, bool) {
+	return s.tree.seek(from, inclusive, bounded, reverse, s.now)
+}
+
+// Release 釋放快照引用的資料段，重複呼叫不會有任何效果。
+// 資料庫關閉後仍可讀取尚未釋放的快照，檔案會在快照釋放時才關閉。
+func (s *Snapshot) Release() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.released {
+		return nil
+	}
+	s.released = true
+
+	var firstErr error
+	for _, seg := range s.segments {
+		if err := seg.release(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.segments = nil
+	return firstErr
+}
@@ -0,0 +1,150 @@
+package bitcask
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultMergeCheckInterval 為自動合併預設的檢查間隔
+const DefaultMergeCheckInterval = time.Minute
+
+// SegmentStats 為單一資料段的空間使用情況
+type SegmentStats struct {
+	ID         uint32
+	Active     bool  // 是否為目前的活躍資料段
+	LiveKeys   int   // 索引仍指向此資料段且尚未過期的 key 數量
+	TotalBytes int64 // 資料段檔案的大小，包含檔頭
+	LiveBytes  int64 // 有效 Entry 佔用的位元組數
+	DeadBytes  int64 // 被覆寫、刪除、過期的 Entry 與批次標記佔用的位元組數，合併後可回收
+}
+
+// Stats 為整個資料庫的空間使用情況
+type Stats struct {
+	LiveKeys      int
+	TotalBytes    int64
+	LiveBytes     int64
+	DeadBytes     int64
+	Fragmentation float64        // DeadBytes 佔 TotalBytes 的比例
+	Segments      []SegmentStats // 依編號由小到大排列
+	LastMerge     time.Time      // 最後一次成功合併的時間，本次開啟後尚未合併時為零值
+}
+
+// Stats 統計每個資料段的有效與無效位元組數。
+// 統計以索引的某一版本為準，只在取得資料段大小與索引版本時短暫持有 mu 的讀鎖，不會等待進行中的寫入。
+// 活躍資料段的大小取自已公開的日誌結尾，尚未完成的寫入（例如進行中的 PutStream）不計入。
+func (bc *Bitcask) Stats() (Stats, error) {
+	bc.mu.RLock()
+	if bc.closed {
+		bc.mu.RUnlock()
+		return Stats{}, ErrClosed
+	}
+
+	// 先取得索引版本再讀日誌結尾，索引中已完成的寫入都落在結尾之前
+	tree := bc.keyDir.snapshot()
+	tail, _ := bc.tail.load()
+	activeID, activeSize := bc.active.id, int64(segmentHeaderSize)
+	if tail.Segment == activeID {
+		activeSize = tail.Offset
+	}
+
+	segs := make(map[uint32]*SegmentStats, len(bc.segments)+1)
+	for id, seg := range bc.segments {
+		segs[id] = &SegmentStats{ID: id, TotalBytes: seg.size}
+	}
+	segs[activeID] = &SegmentStats{ID: activeID, Active: true, TotalBytes: activeSize}
+	lastMerge := bc.lastMerge
+	bc.mu.RUnlock()
+
+	tree.ascendLive("", bc.opts.now().UnixNano(), func(key string, pos KeyDirEntry) bool {
+		// 已更新索引但還沒公開結尾的寫入視為尚未發生
+		if pos.FileID == activeID && pos.ValuePos+int64(pos.ValueSize) > activeSize {
+			return true
+		}
+		if s, ok := segs[pos.FileID]; ok {
+			s.LiveKeys++
+			s.LiveBytes += entryHeaderSize + diskKeySize(len(key), pos.Flags) + int64(pos.ValueSize)
+		}
+		return true
+	})
+
+	stats := Stats{LastMerge: lastMerge}
+	for _, s := range segs {
+		s.DeadBytes = s.TotalBytes - segmentHeaderSize - s.LiveBytes
+		stats.LiveKeys += s.LiveKeys
+		stats.TotalBytes += s.TotalBytes
+		stats.LiveBytes += s.LiveBytes
+		stats.DeadBytes += s.DeadBytes
+		stats.Segments = append(stats.Segments, *s)
+	}
+	sort.Slice(stats.Segments, func(i, j int) bool { return stats.Segments[i].ID < stats.Segments[j].ID })
+	if stats.TotalBytes > 0 {
+		stats.Fragmentation = float64(stats.DeadBytes) / float64(stats.TotalBytes)
+	}
+	return stats, nil
+}
+
+// MergePolicy 決定背景工作何時自動執行合併
+type MergePolicy struct {
+	Interval     time.Duration // 檢查間隔，0 表示使用 DefaultMergeCheckInterval
+	MinDeadRatio float64       // Fragmentation 達到此比例時合併，0 表示不以比例判斷
+	MinDeadBytes int64         // DeadBytes 達到此大小時合併，0 表示不以大小判斷
+	// WindowStart 與 WindowEnd 為一天中允許合併的時段，以距離當地午夜的時間表示，
+	// WindowStart 大於 WindowEnd 時表示跨越午夜；兩者相等表示不限時段
+	WindowStart time.Duration
+	WindowEnd   time.Duration
+}
+
+// shouldMerge 判斷統計結果是否超過合併門檻
+func (p MergePolicy) shouldMerge(s Stats) bool {
+	if s.DeadBytes == 0 {
+		return false
+	}
+	if p.MinDeadRatio > 0 && s.Fragmentation >= p.MinDeadRatio {
+		return true
+	}
+	return p.MinDeadBytes > 0 && s.DeadBytes >= p.MinDeadBytes
+}
+
+// inWindow 判斷 now 是否位於允許合併的時段內
+func (p MergePolicy) inWindow(now time.Time) bool {
+	if p.WindowStart == p.WindowEnd {
+		return true
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	t := now.Sub(midnight)
+	if p.WindowStart < p.WindowEnd {
+		return t >= p.WindowStart && t < p.WindowEnd
+	}
+	return t >= p.WindowStart || t < p.WindowEnd
+}
+
+// autoMerge 定期檢查統計資料，超過門檻且位於允許的時段內時執行合併。
+// 合併失敗時等到下一次檢查再重試。
+func (bc *Bitcask) autoMerge(policy MergePolicy) {
+	defer bc.wg.Done()
+
+	ticker := time.NewTicker(policy.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-bc.stopCh:
+			return
+		case now := <-ticker.C:
+			bc.autoMergeTick(policy, now)
+		}
+	}
+}
+
+// autoMergeTick 為自動合併的一次檢查，返回是否執行了合併
+func (bc *Bitcask) autoMergeTick(policy MergePolicy, now time.Time) bool {
+	if !policy.inWindow(now) {
+		return false
+	}
+	stats, err := bc.Stats()
+	if err != nil || !policy.shouldMerge(stats) {
+		return false
+	}
+	bc.Merge()
+	return true
+}
@@ -0,0 +1,214 @@
+package bitcask
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// PutStream 從 r 讀出剛好 size 個位元組作為 key 的值，直接寫入資料段而不在記憶體中保留整個 value。
+// 先寫入標頭的預留位置，讀完 value 後再補上累計算出的 CRC。
+// 串流寫入的 value 不經過壓縮；啟用加密時 value 以固定大小分段加密，key 同樣加密後寫入。
+// r 提前結束或讀取失敗時，已寫入的部分會被截斷，索引維持原本的值。
+// 寫入期間持有寫入鎖，其他寫入會等待，讀取不受影響。
+func (bc *Bitcask) PutStream(key []byte, r io.Reader, size int64) error {
+	valueSize := size
+	if bc.codec.sealer != nil {
+		valueSize = sealedStreamSize(size)
+	}
+	if size < 0 || valueSize > math.MaxUint32 {
+		return fmt.Errorf("invalid value size %d", size)
+	}
+
+	bc.writeMu.Lock()
+	defer bc.writeMu.Unlock()
+
+	if err := bc.checkWritable(); err != nil {
+		return err
+	}
+
+	diskKey, flags, err := bc.codec.encodeKey(key)
+	if err != nil {
+		return err
+	}
+	entry := &Entry{
+		Key:       diskKey,
+		KeySize:   uint32(len(diskKey)),
+		ValueSize: uint32(valueSize),
+		Mark:      PUT,
+		Timestamp: time.Now().UnixNano(),
+		Seq:       bc.nextSeq(),
+	}
+	if bc.codec.sealer != nil {
+		entry.Flags = flags | FlagEncrypted | FlagChunked
+		entry.KeyID = bc.codec.keyID
+	}
+	total := entry.Size()
+	if err := bc.reserve(total); err != nil {
+		return err
+	}
+
+	seg := bc.active
+	offset := seg.size
+	if err := bc.writeStream(seg, offset, entry, key, r, size); err != nil {
+		// 丟棄寫到一半的 Entry，之後的寫入從原本的尾端繼續
+		if truncErr := seg.file.Truncate(offset); truncErr != nil {
+			return fmt.Errorf("%w (truncate failed: %v)", err, truncErr)
+		}
+		return err
+	}
+
+	seg.size = offset + total
+	bc.unsynced += total
+	if err := bc.maybeSync(); err != nil {
+		return err
+	}
+
+	bc.keyDir.Put(string(key), newKeyDirEntry(seg.id, offset, entry))
+	bc.publish()
+	return nil
+}
+
+// writeStream 在 offset 處依序寫入標頭預留位置、key 與從 r 讀出的 size 個位元組的 value，最後補上標頭。
+// key 為明文的 key，分段加密時作為附加驗證資料。
+func (bc *Bitcask) writeStream(seg *segment, offset int64, entry *Entry, key []byte, r io.Reader, size int64) error {
+	header := make([]byte, entryHeaderSize)
+	w := io.NewOffsetWriter(seg.file, offset)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(entry.Key); err != nil {
+		return err
+	}
+
+	// 標頭中除了 CRC 以外的欄位都已確定，可以先計入 CRC
+	entry.encodeHeader(header)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(entry.Key)
+	dst := io.MultiWriter(w, crc)
+	if entry.Flags&FlagChunked != 0 {
+		if err := sealStream(bc.codec.sealer, key, dst, r, size); err != nil {
+			return err
+		}
+	} else if n, err := io.CopyN(dst, r, size); err != nil {
+		if err == io.EOF {
+			err = fmt.Errorf("value ended after %d of %d bytes: %w", n, size, io.ErrUnexpectedEOF)
+		}
+		return err
+	}
+
+	entry.CRC = crc.Sum32()
+	binary.BigEndian.PutUint32(header[0:4], entry.CRC)
+	_, err := seg.file.WriteAt(header, offset)
+	return err
+}
+
+// GetReader 返回讀取 key 目前的值的 io.ReadCloser，使用完畢必須呼叫 Close。
+// 未壓縮且未加密的 value 直接從資料段串流讀出，讀到結尾時校驗 CRC，不符時返回 *ErrCorrupt；
+// 以 PutStream 分段加密的 value 逐段解密後串流讀出；其他 value 需要完整解碼，會先讀入記憶體。
+// 讀取期間持有資料段的參考，之後的寫入、刪除與合併都不影響已取得的 Reader。
+func (bc *Bitcask) GetReader(key []byte) (io.ReadCloser, error) {
+	bc.mu.RLock()
+	if bc.closed {
+		bc.mu.RUnlock()
+		return nil, ErrClosed
+	}
+	pos, exists := bc.keyDir.Get(string(key))
+	if !exists {
+		bc.mu.RUnlock()
+		return nil, ErrKeyNotFound
+	}
+	seg := bc.segment(pos.FileID)
+	if seg == nil {
+		bc.mu.RUnlock()
+		return nil, fmt.Errorf("segment %d not found", pos.FileID)
+	}
+
+	chunked := pos.Flags&^FlagKeyEncrypted == FlagEncrypted|FlagChunked
+	if pos.Flags&^FlagKeyEncrypted != 0 && !chunked {
+		defer bc.mu.RUnlock()
+		value, err := readValue(seg, bc.codec, key, pos, bc.opts.VerifyChecksum)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(value)), nil
+	}
+
+	seg.acquire()
+	bc.mu.RUnlock()
+
+	r, err := newValueReader(seg, bc.codec, key, pos)
+	if err != nil {
+		seg.release()
+		return nil, err
+	}
+	if chunked {
+		aead, ok := bc.codec.keys[pos.KeyID]
+		if !ok {
+			r.Close()
+			return nil, fmt.Errorf("%w: no key for key id %d", ErrAuthentication, pos.KeyID)
+		}
+		return newStreamReader(aead, pos.KeyID, key, r, int64(pos.ValueSize)), nil
+	}
+	return r, nil
+}
+
+// valueReader 從資料段串流讀出 value，並累計 CRC 在讀到結尾時校驗
+type valueReader struct {
+	seg    *segment
+	offset int64 // Entry 的偏移量，用於錯誤訊息
+	r      *io.SectionReader
+	crc    uint32
+	want   uint32
+	once   sync.Once
+}
+
+// newValueReader 讀出 Entry 的標頭與 key 並確認與索引相符，之後只讀取 value 的範圍
+func newValueReader(seg *segment, codec *valueCodec, key []byte, pos KeyDirEntry) (*valueReader, error) {
+	offset := pos.entryOffset(len(key))
+	buf := make([]byte, entryHeaderSize+diskKeySize(len(key), pos.Flags))
+	if _, err := seg.file.ReadAt(buf, offset); err != nil {
+		return nil, &ErrCorrupt{Segment: seg.id, Offset: offset, Err: err}
+	}
+
+	entry := &Entry{}
+	entry.decodeHeader(buf)
+	entry.Key = buf[entryHeaderSize:]
+	stored, err := codec.entryKey(entry)
+	if err != nil {
+		return nil, err
+	}
+	if entry.ValueSize != pos.ValueSize || !bytes.Equal(stored, key) {
+		return nil, &ErrCorrupt{Segment: seg.id, Offset: offset, Err: errKeyMismatch}
+	}
+
+	return &valueReader{
+		seg:    seg,
+		offset: offset,
+		r:      io.NewSectionReader(seg.file, pos.ValuePos, int64(pos.ValueSize)),
+		crc:    crc32.ChecksumIEEE(buf[4:]),
+		want:   entry.CRC,
+	}, nil
+}
+
+func (v *valueReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.crc = crc32.Update(v.crc, crc32.IEEETable, p[:n])
+	if err == io.EOF && v.crc != v.want {
+		return n, &ErrCorrupt{Segment: v.seg.id, Offset: v.offset, Err: ErrChecksum}
+	}
+	return n, err
+}
+
+// Close 釋放資料段的參考，可重複呼叫
+func (v *valueReader) Close() error {
+	var err error
+	v.once.Do(func() { err = v.seg.release() })
+	return err
+}
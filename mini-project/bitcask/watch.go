@@ -0,0 +1,305 @@
+package bitcask
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrCompacted 表示要繼續讀取的日誌位置已經被合併改寫，無法再從該位置接續
+var ErrCompacted = errors.New("log position has been compacted")
+
+// watchBufferSize 為 Watcher 事件通道的緩衝大小
+const watchBufferSize = 64
+
+// Position 為日誌中的位置：資料段編號與段內的偏移量
+type Position struct {
+	Segment uint32
+	Offset  int64
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Segment, p.Offset)
+}
+
+// EventType 為變更事件的類型
+type EventType uint8
+
+const (
+	EventPut EventType = iota + 1
+	EventDelete
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventPut:
+		return "put"
+	case EventDelete:
+		return "delete"
+	default:
+		return fmt.Sprintf("EventType(%d)", uint8(t))
+	}
+}
+
+// Event 為一筆 key 的變更
+type Event struct {
+	Type      EventType
+	Key       []byte
+	Value     []byte   // 寫入後的值，刪除時為 nil
+	ExpiresAt int64    // 寫入時設定的過期時間 (UnixNano)，0 表示永不過期
+	Version   uint64   // 此次寫入或刪除的版本號
+	Position  Position // 此事件之後的日誌位置，傳給 WatchFrom 可從下一個事件繼續
+}
+
+// logTail 記錄日誌目前已完成寫入的結尾，並在結尾前進時喚醒等待中的 Watcher
+type logTail struct {
+	mu      sync.Mutex
+	pos     Position
+	changed chan struct{} // 結尾前進時關閉並換成新的通道
+}
+
+func newLogTail(pos Position) *logTail {
+	return &logTail{pos: pos, changed: make(chan struct{})}
+}
+
+// advance 將結尾移到 pos 並通知等待者
+func (t *logTail) advance(pos Position) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pos = pos
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// load 返回目前的結尾，以及下次前進時會被關閉的通道
+func (t *logTail) load() (Position, <-chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.pos, t.changed
+}
+
+// publish 在寫入與更新索引之後公開新的日誌結尾，呼叫前需持有 writeMu
+func (bc *Bitcask) publish() {
+	bc.tail.advance(Position{Segment: bc.active.id, Offset: bc.active.size})
+}
+
+// Watcher 依日誌順序送出以某個前綴開頭之 key 的變更事件。
+// 事件直接從資料段檔案讀出，消費得慢只會讓 Watcher 落後，不會阻擋寫入。
+type Watcher struct {
+	bc     *Bitcask
+	prefix []byte
+	events chan Event
+	done   chan struct{}
+	once   sync.Once
+	wg     sync.WaitGroup
+	err    error // 事件通道關閉的原因，通道關閉後才可讀取
+}
+
+// Watch 監看之後寫入且以 prefix 開頭的 key，prefix 為空時監看所有 key。
+// 批次中的操作在批次提交後才會送出；過期與合併不會產生事件。
+func (bc *Bitcask) Watch(prefix []byte) (*Watcher, error) {
+	bc.writeMu.Lock()
+	defer bc.writeMu.Unlock()
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if bc.closed {
+		return nil, ErrClosed
+	}
+	bc.active.acquire()
+	return bc.startWatcher(prefix, bc.active, bc.active.size), nil
+}
+
+// WatchFrom 從日誌位置 from 開始監看，通常傳入上次處理的最後一個事件的 Position 以接續中斷的監看。
+// from 為零值時從最舊的資料段開始，已合併的資料段中只剩每個 key 的最新值。
+// from 所在的資料段已被合併改寫時返回 ErrCompacted，呼叫者需要重新取得完整的資料後再監看。
+func (bc *Bitcask) WatchFrom(prefix []byte, from Position) (*Watcher, error) {
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if bc.closed {
+		return nil, ErrClosed
+	}
+
+	var seg *segment
+	if from == (Position{}) {
+		seg = bc.segment(bc.oldestSegment())
+	} else if seg = bc.segment(from.Segment); seg == nil || from.Segment < bc.compacted {
+		return nil, fmt.Errorf("%w: %v", ErrCompacted, from)
+	}
+	seg.acquire()
+	return bc.startWatcher(prefix, seg, max(from.Offset, segmentHeaderSize)), nil
+}
+
+// oldestSegment 返回編號最小的資料段，呼叫前需持有 mu
+func (bc *Bitcask) oldestSegment() uint32 {
+	oldest := bc.active.id
+	for id := range bc.segments {
+		oldest = min(oldest, id)
+	}
+	return oldest
+}
+
+// startWatcher 從 seg 的 offset 處開始監看，seg 必須已經增加過參考計數
+func (bc *Bitcask) startWatcher(prefix []byte, seg *segment, offset int64) *Watcher {
+	w := &Watcher{
+		bc:     bc,
+		prefix: append([]byte(nil), prefix...),
+		events: make(chan Event, watchBufferSize),
+		done:   make(chan struct{}),
+	}
+	w.wg.Add(1)
+	go w.run(seg, offset)
+	return w
+}
+
+// Events 返回事件通道；Watcher 結束時通道會被關閉，結束原因由 Err 取得
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// Err 返回事件通道關閉的原因：資料庫關閉時為 ErrClosed，落後到已合併的資料段時為 ErrCompacted，
+// 由 Close 主動結束時為 nil。必須在事件通道關閉後呼叫。
+func (w *Watcher) Err() error {
+	return w.err
+}
+
+// Close 停止監看並等待背景工作結束，可重複呼叫
+func (w *Watcher) Close() error {
+	w.once.Do(func() { close(w.done) })
+	w.wg.Wait()
+	return nil
+}
+
+// run 從 seg 的 offset 處開始依序讀取日誌，追上結尾後等待新的寫入
+func (w *Watcher) run(seg *segment, offset int64) {
+	defer w.wg.Done()
+	defer func() {
+		seg.release()
+		if w.err == errWatcherClosed {
+			w.err = nil
+		}
+		close(w.events)
+	}()
+
+	replay := newBatchReplay(func(e *Entry, offset int64) {
+		w.send(e, Position{Segment: seg.id, Offset: offset + e.Size()})
+	})
+	for {
+		end, changed := w.bc.tail.load()
+
+		// 仍在活躍資料段中時只讀到已公開的結尾；日誌結尾已移到之後的資料段時，此資料段不再改變
+		sealed := seg.id < end.Segment
+		limit := end.Offset
+		if sealed {
+			limit = seg.size
+		}
+
+		for offset < limit && w.err == nil {
+			entry, err := readEntryAt(seg.file, offset, limit)
+			if err != nil {
+				w.err = &ErrCorrupt{Segment: seg.id, Offset: offset, Err: err}
+				return
+			}
+			replay.add(entry, offset)
+			offset += entry.Size()
+		}
+		if w.err != nil {
+			return
+		}
+
+		if sealed {
+			// 換到下一個資料段；批次不會跨越資料段
+			next, err := w.next(seg)
+			if err != nil {
+				w.err = err
+				return
+			}
+			seg.release()
+			seg, offset = next, segmentHeaderSize
+			replay.reset()
+			continue
+		}
+
+		select {
+		case <-changed:
+		case <-w.done:
+			return
+		case <-w.bc.stopCh:
+			w.err = ErrClosed
+			return
+		}
+	}
+}
+
+// next 取得 cur 之後的下一個資料段並增加參考計數。
+// 合併會改寫所有編號小於 compacted 的資料段：cur 在讀取期間被合併取代，
+// 且下一個資料段也在合併範圍內時，中間的變更已經遺失，返回 ErrCompacted。
+func (w *Watcher) next(cur *segment) (*segment, error) {
+	bc := w.bc
+	bc.mu.RLock()
+	defer bc.mu.RUnlock()
+
+	if bc.closed {
+		return nil, ErrClosed
+	}
+
+	id := bc.active.id
+	for sid := range bc.segments {
+		if sid > cur.id && sid < id {
+			id = sid
+		}
+	}
+	if bc.segment(cur.id) != cur && id < bc.compacted {
+		return nil, fmt.Errorf("%w: %v", ErrCompacted, Position{Segment: id})
+	}
+
+	seg := bc.segment(id)
+	seg.acquire()
+	return seg, nil
+}
+
+// send 將符合前綴的 PUT 與 DEL 轉為事件送出，Watcher 需要結束時在 w.err 記錄原因
+func (w *Watcher) send(e *Entry, pos Position) {
+	if w.err != nil || (e.Mark != PUT && e.Mark != DEL) {
+		return
+	}
+	key, err := w.bc.codec.entryKey(e)
+	if err != nil {
+		w.err = fmt.Errorf("error decrypting key at %v: %w", pos, err)
+		return
+	}
+	if !bytes.HasPrefix(key, w.prefix) {
+		return
+	}
+
+	ev := Event{
+		Type:      EventPut,
+		Key:       append([]byte(nil), key...),
+		ExpiresAt: e.ExpiresAt,
+		Version:   e.Seq,
+		Position:  pos,
+	}
+	if e.Mark == DEL {
+		ev.Type = EventDelete
+	} else {
+		value, err := w.bc.codec.decode(key, e.Flags, e.KeyID, e.Value)
+		if err != nil {
+			w.err = fmt.Errorf("error decoding key %q at %v: %w", key, pos, err)
+			return
+		}
+		ev.Value = value
+	}
+
+	select {
+	case w.events <- ev:
+	case <-w.done:
+		w.err = errWatcherClosed
+	case <-w.bc.stopCh:
+		w.err = ErrClosed
+	}
+}
+
+// errWatcherClosed 讓讀取迴圈在 Close 之後結束，不會被 Err 返回
+var errWatcherClosed = errors.New("watcher closed")
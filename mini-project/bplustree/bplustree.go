@@ -43,6 +43,14 @@ func (tree *BPlusTree) Search(key models.Key) *models.Value {
 	return nil
 }
 
+// Get 與 Search 相同，但在鍵不存在時返回 ErrKeyNotFound
+func (tree *BPlusTree) Get(key models.Key) (*models.Value, error) {
+	if value := tree.Search(key); value != nil {
+		return value, nil
+	}
+	return nil, ErrKeyNotFound
+}
+
 // Update modifies the value associated with a given key, if it exists.
 func (tree *BPlusTree) Update(key models.Key, newValue models.Value) bool {
 	node := tree.searchNode(tree.Root, key)
@@ -57,6 +65,14 @@ func (tree *BPlusTree) Update(key models.Key, newValue models.Value) bool {
 	return false
 }
 
+// Replace 與 Update 相同，但在鍵不存在時返回 ErrKeyNotFound
+func (tree *BPlusTree) Replace(key models.Key, newValue models.Value) error {
+	if !tree.Update(key, newValue) {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
 // Delete removes a key-value pair from the tree.
 func (tree *BPlusTree) Delete(key models.Key) bool {
 	node := tree.searchNode(tree.Root, key)
@@ -72,6 +88,14 @@ func (tree *BPlusTree) Delete(key models.Key) bool {
 	return false
 }
 
+// Remove 與 Delete 相同，但在鍵不存在時返回 ErrKeyNotFound
+func (tree *BPlusTree) Remove(key models.Key) error {
+	if !tree.Delete(key) {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
 // RangeQuery 查詢範圍內的所有鍵值對
 func (tree *BPlusTree) RangeQuery(minKey, maxKey models.Key) []*models.Value {
 	var result []*models.Value
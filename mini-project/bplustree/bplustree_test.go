@@ -0,0 +1,103 @@
+package bplustree
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Mahopanda/mini-project/bplustree/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestTree 建立已插入 1 到 n 的樹，值為鍵的兩倍，n 需小於階數 10 以免節點分裂
+func newTestTree(n int) *BPlusTree {
+	tree := NewBPlusTree(10)
+	for i := 1; i <= n; i++ {
+		tree.Insert(models.Key(i), models.Value{Data: i * 2})
+	}
+	return tree
+}
+
+func TestMissingKey(t *testing.T) {
+	tests := []struct {
+		name string
+		op   func(tree *BPlusTree, key models.Key) error
+	}{
+		{"Get", func(tree *BPlusTree, key models.Key) error {
+			_, err := tree.Get(key)
+			return err
+		}},
+		{"Replace", func(tree *BPlusTree, key models.Key) error {
+			return tree.Replace(key, models.Value{Data: 0})
+		}},
+		{"Remove", func(tree *BPlusTree, key models.Key) error {
+			return tree.Remove(key)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, tree := range []*BPlusTree{NewBPlusTree(10), newTestTree(9)} {
+				assert.ErrorIs(t, tt.op(tree, models.Key(42)), ErrKeyNotFound)
+			}
+			assert.NoError(t, tt.op(newTestTree(9), models.Key(5)))
+		})
+	}
+
+	// 保留返回 bool 的 Update 與 Delete
+	tree := newTestTree(9)
+	assert.False(t, tree.Update(models.Key(42), models.Value{Data: 0}))
+	assert.False(t, tree.Delete(models.Key(42)))
+	assert.True(t, tree.Update(models.Key(5), models.Value{Data: 0}))
+	assert.Equal(t, 0, tree.Search(models.Key(5)).Data)
+	assert.True(t, tree.Delete(models.Key(5)))
+	assert.Nil(t, tree.Search(models.Key(5)))
+	assert.ErrorIs(t, tree.Remove(models.Key(5)), ErrKeyNotFound)
+}
+
+func TestLoadTree(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "tree.gob")
+	require.NoError(t, newTestTree(9).SaveTree(valid))
+	data, err := os.ReadFile(valid)
+	require.NoError(t, err)
+
+	corrupted := append([]byte(nil), data...)
+	for i := len(corrupted) / 2; i < len(corrupted); i++ {
+		corrupted[i] = 0xff
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+		wantErr error
+	}{
+		{"valid", data, nil},
+		{"empty", []byte{}, ErrCorruptTree},
+		{"truncated", data[:len(data)/2], ErrCorruptTree},
+		{"corrupted", corrupted, ErrCorruptTree},
+		{"garbage", []byte("not a tree"), ErrCorruptTree},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			require.NoError(t, os.WriteFile(path, tt.content, 0644))
+
+			tree, err := LoadTree(path)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, tree)
+				return
+			}
+			require.NoError(t, err)
+			value, err := tree.Get(models.Key(7))
+			require.NoError(t, err)
+			assert.Equal(t, 14, value.Data)
+		})
+	}
+
+	// 檔案不存在不是資料損壞
+	_, err = LoadTree(filepath.Join(dir, "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.NotErrorIs(t, err, ErrCorruptTree)
+}
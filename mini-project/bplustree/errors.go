@@ -0,0 +1,10 @@
+package bplustree
+
+import "errors"
+
+var (
+	// ErrKeyNotFound 表示樹中沒有指定的鍵
+	ErrKeyNotFound = errors.New("bplustree: key not found")
+	// ErrCorruptTree 表示從檔案載入的樹資料無法解碼
+	ErrCorruptTree = errors.New("bplustree: corrupt tree file")
+)
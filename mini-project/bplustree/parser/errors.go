@@ -0,0 +1,46 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUnsupportedStatement 表示不支援的 SQL 語句錯誤
+	ErrUnsupportedStatement = errors.New("不支援的 SQL 語句")
+	// ErrEmptyQuery 表示查詢中沒有任何標記
+	ErrEmptyQuery = errors.New("查詢為空")
+	// ErrSyntax 為所有語法錯誤的共同錯誤值，可用 errors.Is(err, ErrSyntax) 判斷
+	ErrSyntax = errors.New("語法錯誤")
+)
+
+// SyntaxError 描述解析失敗的位置與原因，可用 errors.As 取得詳細資訊
+type SyntaxError struct {
+	Pos      int    // 出錯的標記在標記列表中的索引
+	Expected string // 預期的標記，例如 IDENTIFIER 或 FROM
+	Found    string // 實際找到的標記字面值，語句已結束時為空字串
+	Msg      string // 錯誤說明
+}
+
+func (e *SyntaxError) Error() string {
+	found := e.Found
+	if found == "" {
+		found = "語句結尾"
+	}
+	return fmt.Sprintf("語法錯誤：%s（位置 %d，預期 %s，但找到了 %s）", e.Msg, e.Pos, e.Expected, found)
+}
+
+// Is 讓 errors.Is(err, ErrSyntax) 對所有 SyntaxError 成立
+func (e *SyntaxError) Is(target error) bool {
+	return target == ErrSyntax
+}
+
+// syntaxError 以目前的解析位置建立 SyntaxError
+func (p *Parser) syntaxError(expected, msg string) error {
+	return &SyntaxError{
+		Pos:      p.pos,
+		Expected: expected,
+		Found:    p.current().Literal,
+		Msg:      msg,
+	}
+}
@@ -4,17 +4,11 @@
 package parser
 
 import (
-	"errors"
 	"fmt"
 
 	"github.com/Mahopanda/mini-project/bplustree/types"
 )
 
-var (
-	// ErrUnsupportedStatement 表示不支援的 SQL 語句錯誤
-	ErrUnsupportedStatement = errors.New("不支援的 SQL 語句")
-)
-
 // Parser 表示一個 SQL 語句解析器
 type Parser struct {
 	tokens []Token // 輸入的標記列表
@@ -32,7 +26,7 @@ func NewParser(tokens []Token) *Parser {
 // Parse 開始解析標記，返回 SQL 語句結構或錯誤
 func (p *Parser) Parse() (types.Statement, error) {
 	if len(p.tokens) == 0 {
-		return nil, errors.New("查詢為空")
+		return nil, ErrEmptyQuery
 	}
 
 	switch p.tokens[p.pos].Type {
@@ -66,7 +60,7 @@ func (p *Parser) parseSelect() (*types.SelectStatement, error) {
 
 	// 解析第一個欄位
 	if !p.match(tokenIdentifier) {
-		return nil, errors.New("語法錯誤：SELECT 語句中缺少欄位名稱")
+		return nil, p.syntaxError("IDENTIFIER", "SELECT 語句中缺少欄位名稱")
 	}
 	columns = append(columns, p.tokens[p.pos-1].Literal)
 
@@ -74,20 +68,20 @@ func (p *Parser) parseSelect() (*types.SelectStatement, error) {
 	for p.pos < len(p.tokens) && p.tokens[p.pos].Type == tokenComma {
 		p.advance() // 略過逗號
 		if !p.match(tokenIdentifier) {
-			return nil, errors.New("語法錯誤：逗號後缺少欄位名稱")
+			return nil, p.syntaxError("IDENTIFIER", "逗號後缺少欄位名稱")
 		}
 		columns = append(columns, p.tokens[p.pos-1].Literal)
 	}
 
 	// 檢查 FROM 子句
 	if p.pos >= len(p.tokens) || p.tokens[p.pos].Type != tokenKeyword || p.tokens[p.pos].Literal != "FROM" {
-		return nil, errors.New("語法錯誤：缺少 FROM 子句")
+		return nil, p.syntaxError("FROM", "缺少 FROM 子句")
 	}
 	p.advance() // 略過 FROM
 
 	// 解析表名
 	if !p.match(tokenIdentifier) {
-		return nil, errors.New("語法錯誤：缺少表名")
+		return nil, p.syntaxError("IDENTIFIER", "缺少表名")
 	}
 	table := p.tokens[p.pos-1].Literal
 
@@ -120,24 +114,24 @@ func (p *Parser) parseInsert() (types.Statement, error) {
 
 	// 解析表名
 	if !p.match(tokenIdentifier) {
-		return nil, errors.New("語法錯誤：缺少表名")
+		return nil, p.syntaxError("IDENTIFIER", "缺少表名")
 	}
 	table := p.tokens[p.pos-1].Literal
 
 	// 解析欄位列表
 	columns := []string{}
 	if !p.match(tokenLeftParen) {
-		return nil, errors.New("語法錯誤：缺少左括號")
+		return nil, p.syntaxError("LEFT_PAREN", "缺少左括號")
 	}
 
 	for {
 		if !p.match(tokenIdentifier) {
-			return nil, errors.New("語法錯誤：缺少欄位名稱")
+			return nil, p.syntaxError("IDENTIFIER", "缺少欄位名稱")
 		}
 		columns = append(columns, p.tokens[p.pos-1].Literal)
 
 		if p.pos >= len(p.tokens) {
-			return nil, errors.New("語法錯誤：意外的語句結束")
+			return nil, p.syntaxError("COMMA 或 RIGHT_PAREN", "意外的語句結束")
 		}
 
 		if p.tokens[p.pos].Type == tokenRightParen {
@@ -146,14 +140,14 @@ func (p *Parser) parseInsert() (types.Statement, error) {
 		}
 
 		if p.tokens[p.pos].Type != tokenComma {
-			return nil, errors.New("語法錯誤：缺少逗號或右括號")
+			return nil, p.syntaxError("COMMA 或 RIGHT_PAREN", "缺少逗號或右括號")
 		}
 		p.advance() // 略過逗號
 	}
 
 	// 檢查 VALUES 關鍵字
 	if p.pos >= len(p.tokens) || p.tokens[p.pos].Type != tokenKeyword || p.tokens[p.pos].Literal != "VALUES" {
-		return nil, errors.New("語法錯誤：缺少 VALUES 關鍵字")
+		return nil, p.syntaxError("VALUES", "缺少 VALUES 關鍵字")
 	}
 	p.advance() // 略過 VALUES
 
@@ -161,24 +155,24 @@ func (p *Parser) parseInsert() (types.Statement, error) {
 	var values [][]types.Value
 	for {
 		if !p.match(tokenLeftParen) {
-			return nil, errors.New("語法錯誤：缺少左括號")
+			return nil, p.syntaxError("LEFT_PAREN", "缺少左括號")
 		}
 
 		rowValues := []types.Value{}
 		for {
 			if p.pos >= len(p.tokens) {
-				return nil, errors.New("語法錯誤：意外的語句結束")
+				return nil, p.syntaxError("STRING 或 INTEGER", "意外的語句結束")
 			}
 
 			if p.tokens[p.pos].Type == tokenString || p.tokens[p.pos].Type == tokenInteger {
 				rowValues = append(rowValues, types.Value{Literal: p.tokens[p.pos].Literal})
 				p.advance()
 			} else {
-				return nil, errors.New("語法錯誤：缺少值")
+				return nil, p.syntaxError("STRING 或 INTEGER", "缺少值")
 			}
 
 			if p.pos >= len(p.tokens) {
-				return nil, errors.New("語法錯誤：意外的語句結束")
+				return nil, p.syntaxError("COMMA 或 RIGHT_PAREN", "意外的語句結束")
 			}
 
 			if p.tokens[p.pos].Type == tokenRightParen {
@@ -187,7 +181,7 @@ func (p *Parser) parseInsert() (types.Statement, error) {
 			}
 
 			if p.tokens[p.pos].Type != tokenComma {
-				return nil, errors.New("語法錯誤：缺少逗號或右括號")
+				return nil, p.syntaxError("COMMA 或 RIGHT_PAREN", "缺少逗號或右括號")
 			}
 			p.advance() // 略過逗號
 		}
@@ -224,13 +218,13 @@ func (p *Parser) parseUpdate() (*types.UpdateStatement, error) {
 
 	// 解析表名
 	if !p.match(tokenIdentifier) {
-		return nil, errors.New("語法錯誤：缺少表名")
+		return nil, p.syntaxError("IDENTIFIER", "缺少表名")
 	}
 	table := p.tokens[p.pos-1].Literal
 
 	// 解析 SET 關鍵字
 	if p.pos >= len(p.tokens) || p.tokens[p.pos].Type != tokenKeyword || p.tokens[p.pos].Literal != "SET" {
-		return nil, errors.New("語法錯誤：缺少 SET 關鍵字")
+		return nil, p.syntaxError("SET", "缺少 SET 關鍵字")
 	}
 	p.advance() // 略過 SET
 
@@ -240,25 +234,25 @@ func (p *Parser) parseUpdate() (*types.UpdateStatement, error) {
 	for {
 		// 解析欄位名
 		if !p.match(tokenIdentifier) {
-			return nil, errors.New("語法錯誤：缺少欄位名稱")
+			return nil, p.syntaxError("IDENTIFIER", "缺少欄位名稱")
 		}
 		columns = append(columns, p.tokens[p.pos-1].Literal)
 
 		// 解析賦值符號
 		if p.pos >= len(p.tokens) || p.tokens[p.pos].Type != tokenAssign {
-			return nil, errors.New("語法錯誤：缺少賦值符號")
+			return nil, p.syntaxError("ASSIGN", "缺少賦值符號")
 		}
 		p.advance() // 略過賦值符號
 
 		// 解析值
 		if !p.match(tokenString) && !p.match(tokenInteger) {
-			return nil, errors.New("語法錯誤：缺少值")
+			return nil, p.syntaxError("STRING 或 INTEGER", "缺少值")
 		}
 		values = append(values, types.Value{Literal: p.tokens[p.pos-1].Literal})
 
 		// 檢查是否還有更多的欄位值對
 		if p.pos >= len(p.tokens) {
-			return nil, errors.New("語法錯誤：意外的語句結束")
+			return nil, p.syntaxError("COMMA 或 WHERE", "意外的語句結束")
 		}
 
 		if p.tokens[p.pos].Type != tokenComma {
@@ -292,13 +286,13 @@ func (p *Parser) parseDelete() (*types.DeleteStatement, error) {
 
 	// 解析 FROM 關鍵字
 	if p.pos >= len(p.tokens) || p.tokens[p.pos].Type != tokenKeyword || p.tokens[p.pos].Literal != "FROM" {
-		return nil, errors.New("語法錯誤：少 FROM 關鍵字")
+		return nil, p.syntaxError("FROM", "缺少 FROM 關鍵字")
 	}
 	p.advance() // 略過 FROM
 
 	// 解析表名
 	if !p.match(tokenIdentifier) {
-		return nil, errors.New("語法錯誤：缺少表名")
+		return nil, p.syntaxError("IDENTIFIER", "缺少表名")
 	}
 	table := p.tokens[p.pos-1].Literal
 
@@ -325,30 +319,30 @@ func (p *Parser) parseCreateTable() (*types.CreateTableStatement, error) {
 
 	// 檢查 TABLE 關鍵字
 	if p.pos >= len(p.tokens) || p.tokens[p.pos].Type != tokenKeyword || p.tokens[p.pos].Literal != "TABLE" {
-		return nil, errors.New("語法錯誤：缺少 TABLE 關鍵字")
+		return nil, p.syntaxError("TABLE", "缺少 TABLE 關鍵字")
 	}
 	p.advance() // 略過 TABLE
 
 	// 解析表名
 	if !p.match(tokenIdentifier) {
-		return nil, errors.New("語法錯誤：缺少表名")
+		return nil, p.syntaxError("IDENTIFIER", "缺少表名")
 	}
 	tableName := p.tokens[p.pos-1].Literal
 
 	// 解析欄位定義
 	if !p.match(tokenLeftParen) {
-		return nil, errors.New("語法錯誤：缺少左括號")
+		return nil, p.syntaxError("LEFT_PAREN", "缺少左括號")
 	}
 
 	columns := []types.ColumnDefinition{}
 	for {
 		if !p.match(tokenIdentifier) {
-			return nil, errors.New("語法錯誤：缺少欄位名稱")
+			return nil, p.syntaxError("IDENTIFIER", "缺少欄位名稱")
 		}
 		columnName := p.tokens[p.pos-1].Literal
 
 		if !p.match(tokenKeyword) {
-			return nil, errors.New("語法錯誤：缺少欄位類型")
+			return nil, p.syntaxError("KEYWORD", "缺少欄位類型")
 		}
 		columnType := p.tokens[p.pos-1].Literal
 
@@ -358,7 +352,7 @@ func (p *Parser) parseCreateTable() (*types.CreateTableStatement, error) {
 		})
 
 		if p.pos >= len(p.tokens) {
-			return nil, errors.New("語法錯誤：意外的語句結束")
+			return nil, p.syntaxError("COMMA 或 RIGHT_PAREN", "意外的語句結束")
 		}
 
 		if p.tokens[p.pos].Type == tokenRightParen {
@@ -367,7 +361,7 @@ func (p *Parser) parseCreateTable() (*types.CreateTableStatement, error) {
 		}
 
 		if p.tokens[p.pos].Type != tokenComma {
-			return nil, errors.New("語法錯誤：缺少逗號或右括號")
+			return nil, p.syntaxError("COMMA 或 RIGHT_PAREN", "缺少逗號或右括號")
 		}
 		p.advance() // 略過逗號
 	}
@@ -384,13 +378,13 @@ func (p *Parser) parseDropTable() (*types.DropTableStatement, error) {
 
 	// 檢查 TABLE 關鍵字
 	if p.pos >= len(p.tokens) || p.tokens[p.pos].Type != tokenKeyword || p.tokens[p.pos].Literal != "TABLE" {
-		return nil, errors.New("語法錯誤：缺少 TABLE 關鍵字")
+		return nil, p.syntaxError("TABLE", "缺少 TABLE 關鍵字")
 	}
 	p.advance() // 略過 TABLE
 
 	// 解析表名
 	if !p.match(tokenIdentifier) {
-		return nil, errors.New("語法錯誤：缺少表名")
+		return nil, p.syntaxError("IDENTIFIER", "缺少表名")
 	}
 	tableName := p.tokens[p.pos-1].Literal
 
@@ -426,7 +420,7 @@ func (p *Parser) advance() {
 // expect 確保當前標記符合預期，否則返回錯誤
 func (p *Parser) expect(expectedType tokenType) error {
 	if !p.match(expectedType) {
-		return errors.New("語法錯誤：預期 " + expectedType.String() + "，但找到了 " + p.current().Literal)
+		return p.syntaxError(expectedType.String(), "標記不符合預期")
 	}
 	return nil
 }
@@ -435,19 +429,19 @@ func (p *Parser) expect(expectedType tokenType) error {
 func (p *Parser) parseExpression() (types.Expression, error) {
 	// 解析左側
 	if !p.match(tokenIdentifier) {
-		return types.Expression{}, errors.New("語法錯誤：表達式缺少左側標識符")
+		return types.Expression{}, p.syntaxError("IDENTIFIER", "表達式缺少左側標識符")
 	}
 	left := p.tokens[p.pos-1].Literal
 
 	// 解析運算符
 	if !p.match(tokenEquals) {
-		return types.Expression{}, errors.New("語法錯誤：表達式缺少運算符")
+		return types.Expression{}, p.syntaxError("EQUALS", "表達式缺少運算符")
 	}
 	operator := p.tokens[p.pos-1].Literal
 
 	// 解析右側
 	if !p.match(tokenIdentifier) && !p.match(tokenString) && !p.match(tokenInteger) {
-		return types.Expression{}, errors.New("語法錯誤：表達式缺少右側值")
+		return types.Expression{}, p.syntaxError("IDENTIFIER、STRING 或 INTEGER", "表達式缺少右側值")
 	}
 	right := p.tokens[p.pos-1].Literal
 
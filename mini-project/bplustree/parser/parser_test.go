@@ -232,3 +232,38 @@ func TestParseBulkInsert(t *testing.T) {
 	}
 	assert.Equal(t, expectedValues, bulkInsertStmt.Values)
 }
+
+func TestParseErrors(t *testing.T) {
+	_, err := NewParser(nil).Parse()
+	assert.ErrorIs(t, err, ErrEmptyQuery)
+
+	_, err = NewParser([]Token{{Type: tokenKeyword, Literal: "GRANT"}}).Parse()
+	assert.ErrorIs(t, err, ErrUnsupportedStatement)
+
+	tokens := []Token{
+		{Type: tokenKeyword, Literal: "SELECT"},
+		{Type: tokenIdentifier, Literal: "name"},
+		{Type: tokenKeyword, Literal: "WHERE"},
+	}
+	_, err = NewParser(tokens).Parse()
+	assert.ErrorIs(t, err, ErrSyntax)
+
+	var syntaxErr *SyntaxError
+	if assert.ErrorAs(t, err, &syntaxErr) {
+		assert.Equal(t, 2, syntaxErr.Pos)
+		assert.Equal(t, "FROM", syntaxErr.Expected)
+		assert.Equal(t, "WHERE", syntaxErr.Found)
+		assert.Contains(t, err.Error(), "缺少 FROM 子句")
+	}
+
+	// 語句提早結束時 Found 為空字串
+	tokens = []Token{
+		{Type: tokenKeyword, Literal: "DROP"},
+		{Type: tokenKeyword, Literal: "TABLE"},
+	}
+	_, err = NewParser(tokens).Parse()
+	if assert.ErrorAs(t, err, &syntaxErr) {
+		assert.Equal(t, "IDENTIFIER", syntaxErr.Expected)
+		assert.Empty(t, syntaxErr.Found)
+	}
+}
@@ -2,6 +2,7 @@ package bplustree
 
 import (
 	"encoding/gob"
+	"fmt"
 	"os"
 )
 
@@ -18,6 +19,7 @@ func (tree *BPlusTree) SaveTree(filename string) error {
 }
 
 // LoadTree deserializes a B+ tree from a file.
+// 檔案內容無法解碼時返回包裝 ErrCorruptTree 的錯誤
 func LoadTree(filename string) (*BPlusTree, error) {
 	file, err := os.Open(filename)
 	if err != nil {
@@ -28,7 +30,7 @@ func LoadTree(filename string) (*BPlusTree, error) {
 	decoder := gob.NewDecoder(file)
 	var tree BPlusTree
 	if err := decoder.Decode(&tree); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %s: %w", ErrCorruptTree, filename, err)
 	}
 	return &tree, nil
 }
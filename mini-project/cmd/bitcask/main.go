@@ -0,0 +1,329 @@
+// bitcask 為檢查與維護 Bitcask 資料目錄的命令列工具。
+//
+// 用法：
+//
+//	bitcask [-dir 目錄] [-key 金鑰 -key-id 編號] [-compress] <子命令> [參數]
+//
+// 子命令：
+//
+//	get KEY             讀取 key 的值
+//	put KEY VALUE       寫入鍵值對
+//	del KEY             刪除 key
+//	scan --prefix P     列出以 P 開頭的 key
+//	merge               合併資料段
+//	stats               顯示每個資料段的空間使用情況
+//	dump                解碼並列出每一筆 Entry 的位置、類型與 CRC
+//	verify              校驗每一筆 Entry 的 CRC，列出所有損壞的區域
+//	repair DST          將所有有效的 Entry 救回到新的資料目錄 DST
+//	migrate FILE        將舊版的單檔資料庫 FILE (bitcask.db) 轉換到資料目錄
+//	serve [-resp ADDR] [-http ADDR]
+//	                    以 Redis 協定 (RESP) 或 HTTP/JSON 提供網路服務
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Mahopanda/mini-project/bitcask"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// cli 保存全域參數，各子命令依需要以讀寫或唯讀模式開啟資料庫
+type cli struct {
+	dir    string
+	opts   []bitcask.Option
+	stdout io.Writer
+}
+
+// run 解析參數並執行子命令，返回程序的結束代碼
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("bitcask", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dir := fs.String("dir", "bitcask_data", "資料目錄")
+	keyHex := fs.String("key", "", "以十六進位表示的 AES 金鑰，用於讀寫加密的資料")
+	keyID := fs.Uint("key-id", 0, "金鑰編號")
+	compress := fs.Bool("compress", false, "寫入時以 flate 壓縮 value")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "用法：bitcask [選項] <get|put|del|scan|merge|stats|dump|verify|repair|migrate|serve> [參數]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	c := &cli{dir: *dir, stdout: stdout, opts: []bitcask.Option{bitcask.WithSweepInterval(0)}}
+	if *compress {
+		c.opts = append(c.opts, bitcask.WithCompression(bitcask.FlateCompression))
+	}
+	if *keyHex != "" {
+		key, err := hex.DecodeString(*keyHex)
+		if err != nil {
+			fmt.Fprintf(stderr, "bitcask: invalid -key: %v\n", err)
+			return 2
+		}
+		c.opts = append(c.opts, bitcask.WithEncryption(key, uint32(*keyID)))
+	}
+
+	cmd, cmdArgs := fs.Arg(0), fs.Args()[1:]
+	var err error
+	switch cmd {
+	case "get":
+		err = c.get(cmdArgs)
+	case "put":
+		err = c.put(cmdArgs)
+	case "del":
+		err = c.del(cmdArgs)
+	case "scan":
+		err = c.scan(cmdArgs)
+	case "merge":
+		err = c.merge(cmdArgs)
+	case "stats":
+		err = c.stats(cmdArgs)
+	case "dump":
+		err = c.dump(cmdArgs)
+	case "verify":
+		err = c.verify(cmdArgs)
+	case "repair":
+		err = c.repair(cmdArgs)
+	case "migrate":
+		err = c.migrate(cmdArgs)
+	case "serve":
+		err = c.serve(cmdArgs)
+	default:
+		fmt.Fprintf(stderr, "bitcask: unknown command %q\n", cmd)
+		fs.Usage()
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(stderr, "bitcask %s: %v\n", cmd, err)
+		return 1
+	}
+	return 0
+}
+
+// open 開啟資料庫，只讀取的子命令以唯讀模式開啟，可與其他唯讀程序同時執行
+func (c *cli) open(readOnly bool) (*bitcask.Bitcask, error) {
+	opts := c.opts
+	if readOnly {
+		opts = append(opts[:len(opts):len(opts)], bitcask.WithReadOnly())
+	}
+	return bitcask.NewBitcask(c.dir, opts...)
+}
+
+// expectArgs 檢查子命令的參數數量
+func expectArgs(args []string, n int, usage string) error {
+	if len(args) != n {
+		return fmt.Errorf("usage: %s", usage)
+	}
+	return nil
+}
+
+func (c *cli) get(args []string) error {
+	if err := expectArgs(args, 1, "get KEY"); err != nil {
+		return err
+	}
+	db, err := c.open(true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	value, err := db.Get([]byte(args[0]))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "%s\n", value)
+	return nil
+}
+
+func (c *cli) put(args []string) error {
+	if err := expectArgs(args, 2, "put KEY VALUE"); err != nil {
+		return err
+	}
+	db, err := c.open(false)
+	if err != nil {
+		return err
+	}
+	if err := db.Put([]byte(args[0]), []byte(args[1])); err != nil {
+		db.Close()
+		return err
+	}
+	return db.Close()
+}
+
+func (c *cli) del(args []string) error {
+	if err := expectArgs(args, 1, "del KEY"); err != nil {
+		return err
+	}
+	db, err := c.open(false)
+	if err != nil {
+		return err
+	}
+	if err := db.Delete([]byte(args[0])); err != nil {
+		db.Close()
+		return err
+	}
+	return db.Close()
+}
+
+func (c *cli) scan(args []string) error {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	prefix := fs.String("prefix", "", "只列出以此開頭的 key")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("usage: scan --prefix PREFIX: %v", err)
+	}
+	if err := expectArgs(fs.Args(), 0, "scan --prefix PREFIX"); err != nil {
+		return err
+	}
+
+	db, err := c.open(true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for _, key := range db.Scan([]byte(*prefix)) {
+		fmt.Fprintln(c.stdout, key)
+	}
+	return nil
+}
+
+func (c *cli) merge(args []string) error {
+	if err := expectArgs(args, 0, "merge"); err != nil {
+		return err
+	}
+	db, err := c.open(false)
+	if err != nil {
+		return err
+	}
+	if err := db.Merge(); err != nil {
+		db.Close()
+		return err
+	}
+	return db.Close()
+}
+
+func (c *cli) stats(args []string) error {
+	if err := expectArgs(args, 0, "stats"); err != nil {
+		return err
+	}
+	db, err := c.open(true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	stats, err := db.Stats()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "SEGMENT\tKEYS\tTOTAL\tLIVE\tDEAD\t")
+	for _, s := range stats.Segments {
+		id := fmt.Sprintf("%d", s.ID)
+		if s.Active {
+			id += "*"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t\n", id, s.LiveKeys, s.TotalBytes, s.LiveBytes, s.DeadBytes)
+	}
+	fmt.Fprintf(w, "total\t%d\t%d\t%d\t%d\t\n", stats.LiveKeys, stats.TotalBytes, stats.LiveBytes, stats.DeadBytes)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stdout, "fragmentation: %.1f%%\n", stats.Fragmentation*100)
+	if !stats.LastMerge.IsZero() {
+		fmt.Fprintf(c.stdout, "last merge: %s\n", stats.LastMerge.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (c *cli) dump(args []string) error {
+	if err := expectArgs(args, 0, "dump"); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SEGMENT\tOFFSET\tMARK\tFLAGS\tKEYID\tCRC\tSEQ\tTIMESTAMP\tEXPIRES\tKEY\tVALUE_SIZE")
+	err := bitcask.WalkEntries(c.dir, func(segment uint32, offset int64, e *bitcask.Entry) error {
+		_, err := fmt.Fprintf(w, "%d\t%d\t%s\t%#02x\t%d\t%08x\t%d\t%s\t%s\t%q\t%d\n",
+			segment, offset, e.Mark, uint8(e.Flags), e.KeyID, e.CRC, e.Seq,
+			formatNano(e.Timestamp), formatNano(e.ExpiresAt), e.Key, e.ValueSize)
+		return err
+	})
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+func (c *cli) verify(args []string) error {
+	if err := expectArgs(args, 0, "verify"); err != nil {
+		return err
+	}
+
+	report, err := bitcask.Verify(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, region := range report.Corrupt {
+		fmt.Fprintln(c.stdout, region.Error())
+	}
+	if !report.OK() {
+		return fmt.Errorf("found %d corrupted regions, %d valid entries in %d segments",
+			len(report.Corrupt), report.Entries, report.Segments)
+	}
+	fmt.Fprintf(c.stdout, "OK: %d entries in %d segments\n", report.Entries, report.Segments)
+	return nil
+}
+
+func (c *cli) repair(args []string) error {
+	if err := expectArgs(args, 1, "repair DST"); err != nil {
+		return err
+	}
+
+	report, err := bitcask.Repair(c.dir, args[0])
+	if err != nil {
+		return err
+	}
+	for _, region := range report.Corrupt {
+		fmt.Fprintf(c.stdout, "skipped: %v\n", region)
+	}
+	fmt.Fprintf(c.stdout, "repaired %d valid entries from %d segments into %s\n", report.Entries, report.Segments, args[0])
+	return nil
+}
+
+func (c *cli) migrate(args []string) error {
+	if err := expectArgs(args, 1, "migrate FILE"); err != nil {
+		return err
+	}
+
+	if err := bitcask.MigrateLegacyFile(args[0], c.dir, c.opts...); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "migrated %s into %s\n", args[0], c.dir)
+	return nil
+}
+
+// formatNano 將 UnixNano 時間格式化，0 顯示為 -
+func formatNano(ns int64) string {
+	if ns == 0 {
+		return "-"
+	}
+	return time.Unix(0, ns).Format(time.RFC3339Nano)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runCLI 以指定的資料目錄執行命令列工具，返回結束代碼與輸出
+func runCLI(t *testing.T, dir string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(append([]string{"-dir", dir}, args...), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, kv := range [][2]string{{"user:1", "alice"}, {"user:2", "bob"}, {"order:1", "x"}} {
+		code, _, stderr := runCLI(t, dir, "put", kv[0], kv[1])
+		require.Equal(t, 0, code, stderr)
+	}
+	code, _, _ := runCLI(t, dir, "del", "user:2")
+	require.Equal(t, 0, code)
+
+	code, stdout, _ := runCLI(t, dir, "get", "user:1")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "alice\n", stdout)
+
+	code, _, stderr := runCLI(t, dir, "get", "user:2")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "key not found")
+
+	code, stdout, _ = runCLI(t, dir, "scan", "--prefix", "user:")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "user:1\n", stdout)
+
+	code, stdout, _ = runCLI(t, dir, "dump")
+	assert.Equal(t, 0, code)
+	assert.Len(t, strings.Split(strings.TrimSpace(stdout), "\n"), 5, "標題加上四筆 Entry")
+	assert.Contains(t, stdout, "DEL")
+
+	code, stdout, _ = runCLI(t, dir, "verify")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "OK: 4 entries")
+
+	code, _, _ = runCLI(t, dir, "merge")
+	assert.Equal(t, 0, code)
+	code, stdout, _ = runCLI(t, dir, "stats")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "fragmentation: 0.0%")
+
+	code, _, _ = runCLI(t, dir, "unknown")
+	assert.Equal(t, 2, code)
+}
+
+func TestVerifyReportsCorruption(t *testing.T) {
+	dir := t.TempDir()
+	code, _, _ := runCLI(t, dir, "put", "key", "value")
+	require.Equal(t, 0, code)
+
+	path := filepath.Join(dir, "000000000.data")
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	code, stdout, stderr := runCLI(t, dir, "verify")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, "segment 0 is corrupted at offset 16")
+	assert.Contains(t, stderr, "found 1 corrupted regions")
+
+	repaired := filepath.Join(t.TempDir(), "repaired")
+	code, stdout, _ = runCLI(t, dir, "repair", repaired)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "skipped: segment 0 is corrupted at offset 16")
+
+	code, stdout, _ = runCLI(t, repaired, "verify")
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout, "OK: 0 entries in 1 segments")
+}
+
+func TestMigrate(t *testing.T) {
+	// 舊版單檔資料庫的一筆 PUT：KeySize(4) + ValueSize(4) + Mark(2) + CRC(4) + key + value
+	legacy := make([]byte, 14, 14+len("keyvalue"))
+	binary.BigEndian.PutUint32(legacy[0:4], 3)
+	binary.BigEndian.PutUint32(legacy[4:8], 5)
+	binary.BigEndian.PutUint32(legacy[10:14], crc32.ChecksumIEEE([]byte("keyvalue")))
+	legacy = append(legacy, "keyvalue"...)
+	path := filepath.Join(t.TempDir(), "bitcask.db")
+	require.NoError(t, os.WriteFile(path, legacy, 0644))
+
+	dir := filepath.Join(t.TempDir(), "data")
+	code, stdout, stderr := runCLI(t, dir, "migrate", path)
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "migrated")
+
+	code, stdout, _ = runCLI(t, dir, "get", "key")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "value\n", stdout)
+}
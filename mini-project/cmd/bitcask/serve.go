@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Mahopanda/mini-project/bitcask/httpapi"
+	"github.com/Mahopanda/mini-project/bitcask/resp"
+)
+
+// shutdownTimeout 為收到結束訊號後等待處理中請求完成的時間
+const shutdownTimeout = 10 * time.Second
+
+// serve 以網路服務的方式提供資料庫，直到收到 SIGINT 或 SIGTERM 後優雅關閉。
+// -resp 與 -http 可同時啟用，設為空字串時停用。
+func (c *cli) serve(args []string) error {
+	const usage = "serve [-resp ADDR] [-http ADDR]"
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	respAddr := fs.String("resp", ":6379", "RESP (Redis 協定) 的監聽位址")
+	httpAddr := fs.String("http", "", "HTTP/JSON API 的監聽位址")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("usage: %s: %v", usage, err)
+	}
+	if err := expectArgs(fs.Args(), 0, usage); err != nil {
+		return err
+	}
+	if *respAddr == "" && *httpAddr == "" {
+		return fmt.Errorf("usage: %s: no address to listen on", usage)
+	}
+
+	db, err := c.open(false)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// 每個服務結束時送出一個錯誤，優雅關閉時為 nil
+	errc := make(chan error, 2)
+	var shutdowns []func(context.Context) error
+
+	if *respAddr != "" {
+		srv := resp.NewServer(db)
+		go func() {
+			err := srv.ListenAndServe(*respAddr)
+			if errors.Is(err, resp.ErrServerClosed) {
+				err = nil
+			}
+			errc <- err
+		}()
+		shutdowns = append(shutdowns, srv.Shutdown)
+		fmt.Fprintf(c.stdout, "serving RESP on %s\n", *respAddr)
+	}
+	if *httpAddr != "" {
+		srv := &http.Server{Addr: *httpAddr, Handler: httpapi.NewHandler(db)}
+		go func() {
+			err := srv.ListenAndServe()
+			if errors.Is(err, http.ErrServerClosed) {
+				err = nil
+			}
+			errc <- err
+		}()
+		shutdowns = append(shutdowns, srv.Shutdown)
+		fmt.Fprintf(c.stdout, "serving HTTP on %s\n", *httpAddr)
+	}
+
+	// 任一服務異常結束或收到結束訊號時，關閉所有服務
+	pending := len(shutdowns)
+	select {
+	case err = <-errc:
+		pending--
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, shutdown := range shutdowns {
+		if shutdownErr := shutdown(shutdownCtx); err == nil {
+			err = shutdownErr
+		}
+	}
+	for ; pending > 0; pending-- {
+		if serveErr := <-errc; err == nil {
+			err = serveErr
+		}
+	}
+
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}